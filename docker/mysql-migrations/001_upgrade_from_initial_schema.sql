@@ -0,0 +1,24 @@
+-- 最初のsetup.sqlで作成したDBを、現在のsetup.sqlと同じスキーマに移行する
+-- (urlsへのpriority, available_atの追加とインデックスの張り替え、seed_hostsの作成)
+-- setup.sqlで新たに作成したDBには適用済みなので不要
+-- $ mysql -h 127.0.0.1 -P 11112 -u root -p < docker/mysql-migrations/001_upgrade_from_initial_schema.sql
+
+ALTER TABLE gokurou_dev.urls
+    ADD COLUMN priority BIGINT NOT NULL DEFAULT 0 AFTER tab_joined_url,
+    ADD COLUMN available_at BIGINT NOT NULL DEFAULT 0 AFTER randomized_order,
+    DROP INDEX gwn_randomized_order_index,
+    ADD INDEX gwn_priority_randomized_order_available_at_index(gwn, priority, randomized_order, available_at);
+
+CREATE TABLE IF NOT EXISTS gokurou_dev.seed_hosts (
+    host VARCHAR(255) CHARACTER SET ascii NOT NULL PRIMARY KEY
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+ALTER TABLE gokurou_test.urls
+    ADD COLUMN priority BIGINT NOT NULL DEFAULT 0 AFTER tab_joined_url,
+    ADD COLUMN available_at BIGINT NOT NULL DEFAULT 0 AFTER randomized_order,
+    DROP INDEX gwn_randomized_order_index,
+    ADD INDEX gwn_priority_randomized_order_available_at_index(gwn, priority, randomized_order, available_at);
+
+CREATE TABLE IF NOT EXISTS gokurou_test.seed_hosts (
+    host VARCHAR(255) CHARACTER SET ascii NOT NULL PRIMARY KEY
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -5,9 +5,15 @@ CREATE TABLE IF NOT EXISTS gokurou_dev.urls (
     id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
     gwn INTEGER NOT NULL,
     tab_joined_url MEDIUMTEXT CHARACTER SET ascii NOT NULL,
+    priority BIGINT NOT NULL DEFAULT 0,
     randomized_order BIGINT NOT NULL,
+    available_at BIGINT NOT NULL DEFAULT 0,
     created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    INDEX gwn_randomized_order_index(gwn, randomized_order)
+    INDEX gwn_priority_randomized_order_available_at_index(gwn, priority, randomized_order, available_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS gokurou_dev.seed_hosts (
+    host VARCHAR(255) CHARACTER SET ascii NOT NULL PRIMARY KEY
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
 CREATE DATABASE IF NOT EXISTS gokurou_test CHARACTER SET utf8mb4 COLLATE utf8mb4_general_ci;
@@ -16,7 +22,13 @@ CREATE TABLE IF NOT EXISTS gokurou_test.urls (
     id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
     gwn INTEGER NOT NULL,
     tab_joined_url MEDIUMTEXT CHARACTER SET ascii NOT NULL,
+    priority BIGINT NOT NULL DEFAULT 0,
     randomized_order BIGINT NOT NULL,
+    available_at BIGINT NOT NULL DEFAULT 0,
     created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    INDEX gwn_randomized_order_index(gwn, randomized_order)
+    INDEX gwn_priority_randomized_order_available_at_index(gwn, priority, randomized_order, available_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS gokurou_test.seed_hosts (
+    host VARCHAR(255) CHARACTER SET ascii NOT NULL PRIMARY KEY
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -1,13 +1,15 @@
 module github.com/murakmii/gokurou
 
-go 1.12
+go 1.21
 
 require (
+	github.com/andybalholm/brotli v1.0.4
 	github.com/aws/aws-sdk-go v1.23.18
 	github.com/go-sql-driver/mysql v1.4.1
 	github.com/gomodule/redigo v2.0.0+incompatible
 	github.com/google/uuid v1.1.1
 	github.com/hashicorp/golang-lru v0.5.3
+	github.com/klauspost/compress v1.11.13
 	github.com/mattn/go-sqlite3 v1.11.0
 	github.com/sirupsen/logrus v1.4.2
 	github.com/urfave/cli v1.22.1
@@ -16,3 +18,11 @@ require (
 	golang.org/x/text v0.3.0
 	golang.org/x/xerrors v0.0.0-20190717185122-a985d3407aa7
 )
+
+require (
+	github.com/cpuguy83/go-md2man/v2 v2.0.0-20190314233015-f79a8a8ca69d // indirect
+	github.com/jmespath/go-jmespath v0.0.0-20180206201540-c2b33e8439af // indirect
+	github.com/russross/blackfriday/v2 v2.0.1 // indirect
+	github.com/shurcooL/sanitized_anchor_name v1.0.0 // indirect
+	golang.org/x/sys v0.0.0-20190422165155-953cdadca894 // indirect
+)
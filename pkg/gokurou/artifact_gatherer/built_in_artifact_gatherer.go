@@ -29,10 +29,12 @@ type artifactStorage interface {
 
 // デフォルトのbuiltInArtifactGatherer
 // 受け取ったバイト列を改行区切りでストレージに保存する
+// リンクグラフの成果物(gokurou.OutLinks)は、それ専用のファイルとして別途保存する
 type builtInArtifactGatherer struct {
 	storage     artifactStorage
 	keyPrefix   string
 	buffer      *bytes.Buffer
+	linkGraph   *linkGraphBuffer
 	maxBuffered int
 }
 
@@ -53,12 +55,21 @@ func BuiltInArtifactGathererProvider(_ context.Context, conf *gokurou.Configurat
 		storage:     store,
 		keyPrefix:   conf.MustOptionAsString(keyPrefixConfKey),
 		buffer:      bytes.NewBuffer(nil),
+		linkGraph:   newLinkGraphBuffer(),
 		maxBuffered: 50000,
 	}, nil
 }
 
 // 結果収集。定期的にストレージにアップロードする
 func (ag *builtInArtifactGatherer) Collect(ctx context.Context, artifact interface{}) error {
+	if outLinks, ok := artifact.(*gokurou.OutLinks); ok {
+		ag.linkGraph.write(outLinks)
+		if ag.linkGraph.len() < ag.maxBuffered {
+			return nil
+		}
+		return ag.uploadLinkGraph()
+	}
+
 	marshaled, err := json.Marshal(artifact)
 	if err != nil {
 		gokurou.LoggerFromContext(ctx).Warnf("failed to marshal artifact: %v", err)
@@ -77,6 +88,12 @@ func (ag *builtInArtifactGatherer) Collect(ctx context.Context, artifact interfa
 
 // 終了時はバッファに残った結果をアップロード
 func (ag *builtInArtifactGatherer) Finish() error {
+	if ag.linkGraph.len() > 0 {
+		if err := ag.uploadLinkGraph(); err != nil {
+			return err
+		}
+	}
+
 	if ag.buffer.Len() == 0 {
 		return nil
 	}
@@ -85,18 +102,18 @@ func (ag *builtInArtifactGatherer) Finish() error {
 }
 
 // アップロード時のキーを生成する
-func (ag *builtInArtifactGatherer) buildNewKey() (string, error) {
+func (ag *builtInArtifactGatherer) buildNewKey(prefix, ext string) (string, error) {
 	u, err := uuid.NewRandom()
 	if err != nil {
 		return "", err
 	}
 
-	return fmt.Sprintf("%s/%s/%s.log", ag.keyPrefix, time.Now().Format("2006-01-02-15-04"), u.String()), nil
+	return fmt.Sprintf("%s/%s/%s.%s", prefix, time.Now().Format("2006-01-02-15-04"), u.String(), ext), nil
 }
 
 // ストレージへのアップロード処理
 func (ag *builtInArtifactGatherer) upload() error {
-	key, err := ag.buildNewKey()
+	key, err := ag.buildNewKey(ag.keyPrefix, "log")
 	if err != nil {
 		return xerrors.Errorf("failed to build artifact key: %v", err)
 	}
@@ -109,6 +126,36 @@ func (ag *builtInArtifactGatherer) upload() error {
 	return nil
 }
 
+// リンクグラフの辺の一覧とホスト単位のグラフを、gzipで圧縮してアップロードする
+func (ag *builtInArtifactGatherer) uploadLinkGraph() error {
+	files := []struct {
+		prefix string
+		data   []byte
+	}{
+		{prefix: ag.keyPrefix + "/linkgraph/edges", data: ag.linkGraph.edgesTSV()},
+		{prefix: ag.keyPrefix + "/linkgraph/hosts", data: ag.linkGraph.hostsTSV()},
+	}
+
+	for _, file := range files {
+		key, err := ag.buildNewKey(file.prefix, "tsv.gz")
+		if err != nil {
+			return xerrors.Errorf("failed to build link graph key: %v", err)
+		}
+
+		compressed, err := gzipBytes(file.data)
+		if err != nil {
+			return xerrors.Errorf("failed to compress link graph: %v", err)
+		}
+
+		if err = ag.storage.put(key, compressed); err != nil {
+			return xerrors.Errorf("failed to upload link graph: %v", err)
+		}
+	}
+
+	ag.linkGraph.reset()
+	return nil
+}
+
 // artifactStoreを実装したS3を対象にしたストレージ
 type s3ArtifactStorage struct {
 	s3     *s3.S3
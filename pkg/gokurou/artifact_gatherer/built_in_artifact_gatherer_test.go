@@ -2,9 +2,14 @@ package artifact_gatherer
 
 import (
 	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"strings"
 	"testing"
 
 	"github.com/murakmii/gokurou/pkg/gokurou"
+
+	"github.com/murakmii/gokurou/pkg/gokurou/www"
 )
 
 type sampleAtrtifact struct {
@@ -12,10 +17,12 @@ type sampleAtrtifact struct {
 }
 
 type mockArtifactStorage struct {
+	keys   []string
 	putted [][]byte
 }
 
-func (s *mockArtifactStorage) put(_ string, data []byte) error {
+func (s *mockArtifactStorage) put(key string, data []byte) error {
+	s.keys = append(s.keys, key)
 	s.putted = append(s.putted, data)
 	return nil
 }
@@ -26,6 +33,7 @@ func buildBuiltInArtifactGatherer(maxBuffered int) (*mockArtifactStorage, *built
 		storage:     storage,
 		keyPrefix:   "test",
 		buffer:      bytes.NewBuffer(nil),
+		linkGraph:   newLinkGraphBuffer(),
 		maxBuffered: maxBuffered,
 	}
 }
@@ -55,6 +63,39 @@ func TestBuiltInArtifactGatherer_Collect(t *testing.T) {
 		}
 	})
 
+	t.Run("リンクグラフの成果物の場合、専用のファイルとしてアップロードする", func(t *testing.T) {
+		storage, ag := buildBuiltInArtifactGatherer(20)
+		from, _ := www.SanitizedURLFromString("http://example.com/")
+		to, _ := www.SanitizedURLFromString("http://example.org/")
+
+		err := ag.Collect(ctx, &gokurou.OutLinks{From: from, Links: []*www.Link{{URL: to, Text: "example"}}})
+		if err != nil {
+			t.Errorf("Collect() = %v", err)
+		}
+
+		if len(storage.putted) != 2 ||
+			!strings.HasPrefix(storage.keys[0], "test/linkgraph/edges/") ||
+			!strings.HasPrefix(storage.keys[1], "test/linkgraph/hosts/") ||
+			!strings.HasSuffix(storage.keys[0], ".tsv.gz") {
+			t.Errorf("Collect() uploads %v", storage.keys)
+			return
+		}
+
+		r, err := gzip.NewReader(bytes.NewReader(storage.putted[0]))
+		if err != nil {
+			panic(err)
+		}
+
+		got, _ := ioutil.ReadAll(r)
+		if string(got) != "http://example.com/\thttp://example.org/\t\texample\n" {
+			t.Errorf("Collect() uploads %q as edges", got)
+		}
+
+		if ag.buffer.Len() != 0 || ag.linkGraph.len() != 0 {
+			t.Errorf("Collect() does NOT clear buffer")
+		}
+	})
+
 	t.Run("Marshalできない場合でもnilを返す", func(t *testing.T) {
 		_, ag := buildBuiltInArtifactGatherer(20)
 		got := ag.Collect(ctx, make(chan struct{}))
@@ -0,0 +1,98 @@
+package artifact_gatherer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/murakmii/gokurou/pkg/gokurou"
+)
+
+// リンクグラフの成果物を、辺の一覧とホスト単位で集約したグラフとしてバッファする
+// 辺の一覧は"<リンク元URL>\t<リンク先URL>\t<rel>\t<アンカーテキスト>"の行からなるTSVとなる
+// ホスト単位のグラフは"<リンク元ホスト>\t<リンク先ホスト>\t<リンク数>"の行からなるTSVとなり、同一ホスト内のリンクは含まない
+// いずれもアップロードの度にリセットされるため、ホスト単位のグラフを利用する際は全てのファイルについてリンク数を合計すること
+type linkGraphBuffer struct {
+	edges *bytes.Buffer
+	hosts map[hostEdge]int
+}
+
+type hostEdge struct {
+	from string
+	to   string
+}
+
+// TSVの値として不正な文字を置き換える
+var tsvReplacer = strings.NewReplacer("\t", " ", "\r", " ", "\n", " ")
+
+func newLinkGraphBuffer() *linkGraphBuffer {
+	return &linkGraphBuffer{
+		edges: bytes.NewBuffer(nil),
+		hosts: make(map[hostEdge]int),
+	}
+}
+
+func (b *linkGraphBuffer) write(outLinks *gokurou.OutLinks) {
+	from := outLinks.From.String()
+	fromHost := outLinks.From.Hostname()
+
+	for _, link := range outLinks.Links {
+		_, _ = fmt.Fprintf(b.edges, "%s\t%s\t%s\t%s\n", from, link.URL.String(), tsvReplacer.Replace(link.Rel), tsvReplacer.Replace(link.Text))
+
+		if toHost := link.URL.Hostname(); toHost != fromHost {
+			b.hosts[hostEdge{from: fromHost, to: toHost}]++
+		}
+	}
+}
+
+func (b *linkGraphBuffer) len() int {
+	return b.edges.Len()
+}
+
+func (b *linkGraphBuffer) edgesTSV() []byte {
+	return b.edges.Bytes()
+}
+
+// ホスト単位のグラフをリンク元、リンク先の順にソートして返す
+func (b *linkGraphBuffer) hostsTSV() []byte {
+	edges := make([]hostEdge, 0, len(b.hosts))
+	for edge := range b.hosts {
+		edges = append(edges, edge)
+	}
+
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].from != edges[j].from {
+			return edges[i].from < edges[j].from
+		}
+		return edges[i].to < edges[j].to
+	})
+
+	buf := bytes.NewBuffer(nil)
+	for _, edge := range edges {
+		_, _ = fmt.Fprintf(buf, "%s\t%s\t%d\n", edge.from, edge.to, b.hosts[edge])
+	}
+
+	return buf.Bytes()
+}
+
+func (b *linkGraphBuffer) reset() {
+	b.edges.Reset()
+	b.hosts = make(map[hostEdge]int)
+}
+
+func gzipBytes(data []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	w := gzip.NewWriter(buf)
+
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,52 @@
+package artifact_gatherer
+
+import (
+	"testing"
+
+	"github.com/murakmii/gokurou/pkg/gokurou"
+
+	"github.com/murakmii/gokurou/pkg/gokurou/www"
+)
+
+func mustURL(s string) *www.SanitizedURL {
+	url, err := www.SanitizedURLFromString(s)
+	if err != nil {
+		panic(err)
+	}
+	return url
+}
+
+func TestLinkGraphBuffer_write(t *testing.T) {
+	b := newLinkGraphBuffer()
+	b.write(&gokurou.OutLinks{
+		From: mustURL("http://example.com/"),
+		Links: []*www.Link{
+			{URL: mustURL("http://example.com/about"), Text: "About"},
+			{URL: mustURL("http://example.org/"), Text: "Example\tOrg\n", Rel: "nofollow"},
+			{URL: mustURL("http://example.org/a")},
+		},
+	})
+	b.write(&gokurou.OutLinks{
+		From:  mustURL("http://example.com/about"),
+		Links: []*www.Link{{URL: mustURL("http://example.net/")}},
+	})
+
+	wantEdges := "http://example.com/\thttp://example.com/about\t\tAbout\n" +
+		"http://example.com/\thttp://example.org/\tnofollow\tExample Org \n" +
+		"http://example.com/\thttp://example.org/a\t\t\n" +
+		"http://example.com/about\thttp://example.net/\t\t\n"
+	if got := string(b.edgesTSV()); got != wantEdges {
+		t.Errorf("edgesTSV() = %q, want = %q", got, wantEdges)
+	}
+
+	wantHosts := "example.com\texample.net\t1\n" +
+		"example.com\texample.org\t2\n"
+	if got := string(b.hostsTSV()); got != wantHosts {
+		t.Errorf("hostsTSV() = %q, want = %q", got, wantHosts)
+	}
+
+	b.reset()
+	if b.len() != 0 || len(b.hostsTSV()) != 0 {
+		t.Errorf("reset() does NOT clear buffer")
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 
 	"golang.org/x/xerrors"
+
+	"github.com/murakmii/gokurou/pkg/gokurou/www"
 )
 
 type (
@@ -25,6 +27,10 @@ type Configuration struct {
 	AwsSecretAccessKey string
 	AwsS3EndPoint      string
 
+	// URLの正規化ルールとポート指定に関するポリシー。nilの場合はデフォルトのものを用いる
+	CanonicalRules *www.CanonicalRules
+	PortPolicy     *www.PortPolicy
+
 	ArtifactGathererProvider ArtifactGathererProviderFunc
 	URLFrontierProvider      URLFrontierProviderFunc
 	CrawlerProvider          CrawlerProviderFunc
@@ -46,6 +52,11 @@ func (c *Configuration) TotalWorkers() uint {
 	return c.Workers * c.Machines
 }
 
+// 設定された正規化のルールとポート指定に関するポリシーを適用するSanitizerを返す
+func (c *Configuration) Sanitizer() *www.Sanitizer {
+	return www.NewSanitizer(c.CanonicalRules, c.PortPolicy)
+}
+
 func (c *Configuration) OptionAsString(key string) *string {
 	option, exists := c.Options[key]
 	if !exists {
@@ -69,6 +80,44 @@ func (c *Configuration) MustOptionAsString(key string) string {
 	return *str
 }
 
+func (c *Configuration) OptionAsBool(key string) bool {
+	option, exists := c.Options[key]
+	if !exists {
+		return false
+	}
+
+	b, ok := option.(bool)
+	return ok && b
+}
+
+func (c *Configuration) OptionAsInt(key string) int {
+	option, exists := c.Options[key]
+	if !exists {
+		return 0
+	}
+
+	i, ok := option.(int)
+	if !ok {
+		return 0
+	}
+
+	return i
+}
+
+func (c *Configuration) OptionAsStrings(key string) ([]string, error) {
+	option, exists := c.Options[key]
+	if !exists || option == nil {
+		return nil, nil
+	}
+
+	strs, ok := option.([]string)
+	if !ok {
+		return nil, xerrors.Errorf("'%s' config expects value as []string", key)
+	}
+
+	return strs, nil
+}
+
 func (c *Configuration) AwsConfigurationMayBeDummy() bool {
 	return len(c.AwsS3EndPoint) > 0
 }
@@ -15,6 +15,7 @@ const (
 	gwnContextKey    = "GOKUROU_CTX_KEY_GWN"
 	loggerContextKey = "GOKUROU_CTX_KEY_LOGGER"
 	tracerContextKey = "GOKUROU_CTX_KEY_TRACER"
+	coordContextKey  = "GOKUROU_CTX_KEY_COORDINATOR"
 )
 
 func RootContext(conf *Configuration) (context.Context, error) {
@@ -89,6 +90,10 @@ func ContextWithTracer(ctx context.Context, tracer Tracer) context.Context {
 	return context.WithValue(ctx, tracerContextKey, tracer)
 }
 
+func ContextWithCoordinator(ctx context.Context, coordinator Coordinator) context.Context {
+	return context.WithValue(ctx, coordContextKey, coordinator)
+}
+
 func LoggerFromContext(ctx context.Context) *logrus.Entry {
 	logger, ok := ctx.Value(loggerContextKey).(*logrus.Entry)
 	if !ok {
@@ -115,3 +120,12 @@ func TracerFromContext(ctx context.Context) Tracer {
 
 	return tracer
 }
+
+func CoordinatorFromContext(ctx context.Context) Coordinator {
+	coordinator, ok := ctx.Value(coordContextKey).(Coordinator)
+	if !ok {
+		panic(xerrors.New("can't fetch coordinator from context"))
+	}
+
+	return coordinator
+}
@@ -1,7 +1,14 @@
 package coordinator
 
 import (
+	"fmt"
 	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/murakmii/gokurou/pkg/gokurou/www"
 
 	"github.com/murakmii/gokurou/pkg/gokurou"
 
@@ -10,12 +17,27 @@ import (
 
 const (
 	redisURLConfKey = "built_in.redis_url"
+
+	// SimHashを分割して索引とする際の分割数と、類似とみなすハミング距離の最大値
+	// 分割数より小さい距離であれば、いずれかの分割は必ず一致するため索引から候補を見つけられる
+	simHashBands       = 4
+	maxSimHashDistance = simHashBands - 1
+
+	// 重複判定のために記録したハッシュ値を保持する期間と、SimHashの索引1つあたりに保持するページ数の上限
+	// 上限を超えた索引からはランダムに選んだページを取り除く
+	duplicateContentTTL   = 7 * 24 * time.Hour
+	maxSimHashBandMembers = 1000
 )
 
 // TODO: Redis関連のエラーは何回かは許容&リトライしたい
+// 1つのworker内でもURLFrontierとCrawlerのgoroutineから並行して呼ばれるため、connへのアクセスはmuで排他する
+// (redigoのConnは並行して用いることができず、MULTIの途中に他のコマンドが割り込むとキューに積まれてしまう)
 type builtInCoordinator struct {
-	conn         redis.Conn
-	nameResolver func(host string) ([]net.IP, error)
+	mu             sync.Mutex
+	conn           redis.Conn
+	nameResolver   func(host string) ([]net.IP, error)
+	dupTTL         time.Duration
+	maxBandMembers int
 }
 
 func BuiltInCoordinatorProvider(conf *gokurou.Configuration) (gokurou.Coordinator, error) {
@@ -25,15 +47,20 @@ func BuiltInCoordinatorProvider(conf *gokurou.Configuration) (gokurou.Coordinato
 	}
 
 	return &builtInCoordinator{
-		conn:         conn,
-		nameResolver: net.LookupIP,
+		conn:           conn,
+		nameResolver:   net.LookupIP,
+		dupTTL:         duplicateContentTTL,
+		maxBandMembers: maxSimHashBandMembers,
 	}, nil
 }
 
 func (c *builtInCoordinator) AllocNextGWN() (uint16, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	gwn, err := redis.Uint64(c.conn.Do("INCR", "gokurou_workers"))
 	if err != nil {
-		_ = c.Finish()
+		_ = c.conn.Close()
 		return 0, err
 	}
 
@@ -51,6 +78,9 @@ func (c *builtInCoordinator) LockByIPAddrOf(host string) (bool, error) {
 		lockKeys[i] = "l-" + ip.String()
 	}
 
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	mSetNXArgs := make([]interface{}, len(ips)*2)
 	mSetNXArgs[0] = "MSETNX"
 	for i, key := range lockKeys {
@@ -86,15 +116,132 @@ func (c *builtInCoordinator) LockByIPAddrOf(host string) (bool, error) {
 	return true, nil
 }
 
+func (c *builtInCoordinator) ExtendLockByIPAddrOf(host string, ttl time.Duration) error {
+	ips, err := c.nameResolver(host)
+	if err != nil {
+		return nil // LockByIPAddrOfと同様に、名前解決の失敗はエラーにしない
+	}
+
+	// キーの数が可変なスクリプトには、先頭にキーの数を与える
+	args := make([]interface{}, 0, len(ips)+2)
+	args = append(args, len(ips))
+	for _, ip := range ips {
+		args = append(args, "l-"+ip.String())
+	}
+	args = append(args, int64(ttl/time.Millisecond))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, err = extendLockScript.Do(c.conn, args...)
+	return err
+}
+
+// 各キーの残りのTTLが指定したミリ秒より短い場合のみ、TTLを延長(ロックされていなければロック)する
+// TTLの確認と延長の間に他のworkerが割り込まないよう、1つのスクリプトで実行する
+var extendLockScript = redis.NewScript(-1, `
+local ms = tonumber(ARGV[1])
+for _, key in ipairs(KEYS) do
+	if redis.call("PTTL", key) < ms then
+		redis.call("SET", key, "1", "PX", ms)
+	end
+end
+return 0
+`)
+
+// SimHashの索引にページを加える。索引が上限に達している場合は、ランダムに選んだページを取り除いてから加える
+// 索引の有効期限は、ページを加える度に延長する
+var addSimHashScript = redis.NewScript(-1, `
+local member, ms, limit = ARGV[1], tonumber(ARGV[2]), tonumber(ARGV[3])
+for _, key in ipairs(KEYS) do
+	local excess = redis.call("SCARD", key) - limit + 1
+	if excess > 0 then
+		redis.call("SPOP", key, excess)
+	end
+	redis.call("SADD", key, member)
+	redis.call("PEXPIRE", key, ms)
+end
+return 0
+`)
+
+func (c *builtInCoordinator) FindDuplicateContent(url string, contentHash string, simHash uint64) (*gokurou.DuplicateContent, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// ハッシュ値が完全一致するページは、最初に記録したページのURLをキーに紐付けて判定する
+	hashKey := "ch-" + contentHash
+	_, err := redis.String(c.conn.Do("SET", hashKey, url, "NX", "PX", int64(c.dupTTL/time.Millisecond)))
+	if err == redis.ErrNil {
+		dupURL, err := redis.String(c.conn.Do("GET", hashKey))
+		if err != nil && err != redis.ErrNil {
+			return nil, err
+		}
+
+		if dupURL != url {
+			return &gokurou.DuplicateContent{URL: dupURL}, nil
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	// SimHashを16bit毎に分割したものを索引とし、同じ索引に属するSimHashとの距離で類似を判定する
+	// 索引には"SimHashの16進数表現 URL"を記録する
+	member := fmt.Sprintf("%016x %s", simHash, url)
+	bandKeys := make([]string, simHashBands)
+	for band := 0; band < simHashBands; band++ {
+		bandKeys[band] = fmt.Sprintf("sh-%d-%04x", band, (simHash>>(uint(band)*16))&0xffff)
+
+		candidates, err := redis.Strings(c.conn.Do("SMEMBERS", bandKeys[band]))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, candidate := range candidates {
+			parts := strings.SplitN(candidate, " ", 2)
+			if len(parts) != 2 || parts[1] == url {
+				continue
+			}
+
+			candidateHash, err := strconv.ParseUint(parts[0], 16, 64)
+			if err != nil {
+				continue
+			}
+
+			if www.HammingDistance(simHash, candidateHash) <= maxSimHashDistance {
+				return &gokurou.DuplicateContent{URL: parts[1], Near: true}, nil
+			}
+		}
+	}
+
+	args := make([]interface{}, 0, len(bandKeys)+4)
+	args = append(args, len(bandKeys))
+	for _, key := range bandKeys {
+		args = append(args, key)
+	}
+	args = append(args, member, int64(c.dupTTL/time.Millisecond), c.maxBandMembers)
+
+	if _, err := addSimHashScript.Do(c.conn, args...); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
 func (c *builtInCoordinator) Finish() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	return c.conn.Close()
 }
 
 func (c *builtInCoordinator) Reset() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	_, err := c.conn.Do("FLUSHALL")
 	if err != nil {
 		return err
 	}
 
-	return c.Finish()
+	return c.conn.Close()
 }
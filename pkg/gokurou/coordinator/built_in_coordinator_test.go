@@ -1,8 +1,13 @@
 package coordinator
 
 import (
+	"fmt"
 	"net"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/murakmii/gokurou/pkg/gokurou"
 
 	"golang.org/x/xerrors"
 
@@ -21,8 +26,10 @@ func buildBuiltInCoordinator(resolver func(string) ([]net.IP, error)) *builtInCo
 	}
 
 	return &builtInCoordinator{
-		conn:         conn,
-		nameResolver: resolver,
+		conn:           conn,
+		nameResolver:   resolver,
+		dupTTL:         duplicateContentTTL,
+		maxBandMembers: maxSimHashBandMembers,
 	}
 }
 
@@ -132,6 +139,209 @@ func TestBuiltInCoordinator_LockByIPAddrOf(t *testing.T) {
 	})
 }
 
+func TestBuiltInCoordinator_ExtendLockByIPAddrOf(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(*builtInCoordinator)
+		ttl   time.Duration
+		want  int64
+	}{
+		{
+			name:  "ロックされていない場合、与えられた時間だけロックする",
+			setup: func(_ *builtInCoordinator) {},
+			ttl:   120 * time.Second,
+			want:  120,
+		},
+		{
+			name: "ロックの残り時間が短い場合、延長する",
+			setup: func(coordinator *builtInCoordinator) {
+				_, _ = coordinator.conn.Do("SETEX", "l-192.168.0.1", 60, 1)
+				_, _ = coordinator.conn.Do("SETEX", "l-192.168.0.2", 60, 1)
+			},
+			ttl:  120 * time.Second,
+			want: 120,
+		},
+		{
+			name: "ロックの残り時間が長い場合、何もしない",
+			setup: func(coordinator *builtInCoordinator) {
+				_, _ = coordinator.conn.Do("SETEX", "l-192.168.0.1", 600, 1)
+				_, _ = coordinator.conn.Do("SETEX", "l-192.168.0.2", 600, 1)
+			},
+			ttl:  120 * time.Second,
+			want: 600,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			coordinator := buildBuiltInCoordinator(mockSuccessfulNameResolver)
+			tt.setup(coordinator)
+
+			if err := coordinator.ExtendLockByIPAddrOf("example.com", tt.ttl); err != nil {
+				t.Errorf("ExtendLockByIPAddrOf() = %v", err)
+			}
+
+			for _, key := range []string{"l-192.168.0.1", "l-192.168.0.2"} {
+				ttl, _ := redis.Int64(coordinator.conn.Do("TTL", key))
+				if ttl < tt.want-5 || ttl > tt.want {
+					t.Errorf("ExtendLockByIPAddrOf() set TTL %d for %s, want = %d", ttl, key, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBuiltInCoordinator_FindDuplicateContent(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(*builtInCoordinator)
+		url   string
+		hash  string
+		sim   uint64
+		want  *gokurou.DuplicateContent
+	}{
+		{
+			name:  "重複するページがない場合、nilを返す",
+			setup: func(_ *builtInCoordinator) {},
+			url:   "http://example.com",
+			hash:  "hash",
+			sim:   0x0123456789abcdef,
+			want:  nil,
+		},
+		{
+			name: "ハッシュ値が一致するページがある場合、そのURLを返す",
+			setup: func(coordinator *builtInCoordinator) {
+				_, _ = coordinator.FindDuplicateContent("http://example.com", "hash", 0x0123456789abcdef)
+			},
+			url:  "http://mirror.example.com",
+			hash: "hash",
+			sim:  0xfedcba9876543210,
+			want: &gokurou.DuplicateContent{URL: "http://example.com"},
+		},
+		{
+			name: "SimHashが近いページがある場合、そのURLを返す",
+			setup: func(coordinator *builtInCoordinator) {
+				_, _ = coordinator.FindDuplicateContent("http://example.com", "hash", 0x0123456789abcdef)
+			},
+			url:  "http://mirror.example.com",
+			hash: "other-hash",
+			sim:  0x0123456789abcde8,
+			want: &gokurou.DuplicateContent{URL: "http://example.com", Near: true},
+		},
+		{
+			name: "SimHashが遠いページしかない場合、nilを返す",
+			setup: func(coordinator *builtInCoordinator) {
+				_, _ = coordinator.FindDuplicateContent("http://example.com", "hash", 0x0123456789abcdef)
+			},
+			url:  "http://other.example.com",
+			hash: "other-hash",
+			sim:  0x0123456789ab3210,
+			want: nil,
+		},
+		{
+			name: "同じURLで記録されていた場合、重複とみなさない",
+			setup: func(coordinator *builtInCoordinator) {
+				_, _ = coordinator.FindDuplicateContent("http://example.com", "hash", 0x0123456789abcdef)
+			},
+			url:  "http://example.com",
+			hash: "hash",
+			sim:  0x0123456789abcdef,
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			coordinator := buildBuiltInCoordinator(mockSuccessfulNameResolver)
+			tt.setup(coordinator)
+
+			got, err := coordinator.FindDuplicateContent(tt.url, tt.hash, tt.sim)
+			if err != nil {
+				t.Errorf("FindDuplicateContent() = %v", err)
+			}
+
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("FindDuplicateContent() = %+v, want = %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuiltInCoordinator_FindDuplicateContent_Expiration(t *testing.T) {
+	t.Run("記録したハッシュ値と索引に有効期限を設定する", func(t *testing.T) {
+		coordinator := buildBuiltInCoordinator(mockSuccessfulNameResolver)
+		defer coordinator.Finish()
+
+		if _, err := coordinator.FindDuplicateContent("http://example.com", "hash", 0x0123456789abcdef); err != nil {
+			t.Errorf("FindDuplicateContent() = %v", err)
+		}
+
+		keys := []string{"ch-hash", "sh-0-cdef", "sh-1-89ab", "sh-2-4567", "sh-3-0123"}
+		for _, key := range keys {
+			ttl, _ := redis.Int64(coordinator.conn.Do("TTL", key))
+			if ttl <= 0 || ttl > int64(duplicateContentTTL/time.Second) {
+				t.Errorf("FindDuplicateContent() set TTL %d for %s", ttl, key)
+			}
+		}
+	})
+
+	t.Run("索引が上限に達している場合、他のページを取り除いてから加える", func(t *testing.T) {
+		coordinator := buildBuiltInCoordinator(mockSuccessfulNameResolver)
+		defer coordinator.Finish()
+		coordinator.maxBandMembers = 3
+
+		// 下位16bitが共通で他は遠いSimHashを記録し、同じ索引に溜める
+		for i := uint64(1); i <= 5; i++ {
+			url := fmt.Sprintf("http://example.com/%d", i)
+			if _, err := coordinator.FindDuplicateContent(url, url, i*0x1111111111110000+0xabcd); err != nil {
+				t.Errorf("FindDuplicateContent() = %v", err)
+			}
+		}
+
+		members, _ := redis.Strings(coordinator.conn.Do("SMEMBERS", "sh-0-abcd"))
+		if len(members) != 3 {
+			t.Errorf("FindDuplicateContent() keeps %d members, want = 3", len(members))
+		}
+
+		last, _ := redis.Bool(coordinator.conn.Do("SISMEMBER", "sh-0-abcd", fmt.Sprintf("%016x http://example.com/5", 5*uint64(0x1111111111110000)+0xabcd)))
+		if !last {
+			t.Errorf("FindDuplicateContent() removes the latest member")
+		}
+	})
+}
+
+func TestBuiltInCoordinator_Concurrently(t *testing.T) {
+	// URLFrontierとCrawlerのgoroutineから並行して呼ばれても、互いのコマンドが混ざらない
+	coordinator := buildBuiltInCoordinator(mockSuccessfulNameResolver)
+	defer coordinator.Finish()
+
+	wg := &sync.WaitGroup{}
+	errs := make(chan error, 200)
+	for i := 0; i < 100; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := coordinator.LockByIPAddrOf("www.example.com"); err != nil {
+				errs <- err
+			}
+		}(i)
+
+		go func(i int) {
+			defer wg.Done()
+			url := fmt.Sprintf("http://www.example.com/%d", i)
+			if _, err := coordinator.FindDuplicateContent(url, fmt.Sprintf("hash-%d", i), uint64(i)); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("concurrent call returns error: %v", err)
+	}
+}
+
 func TestBuiltInCoordinator_Finish(t *testing.T) {
 	err := buildBuiltInCoordinator(mockSuccessfulNameResolver).Finish()
 	if err != nil {
@@ -0,0 +1,52 @@
+package crawler
+
+import (
+	"io"
+)
+
+// 上限のサイズまでしか読み込まないReader
+// io.LimitReaderと異なり、上限を超える内容があったために打ち切ったかどうかを記録する
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+	done      bool // 上限に達した後、続きがあるかを確かめたならtrue
+	truncated bool
+}
+
+func newLimitedReader(r io.Reader, limit int64) *limitedReader {
+	return &limitedReader{r: r, remaining: limit}
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	if lr.remaining <= 0 {
+		if !lr.done {
+			lr.probe()
+		}
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > lr.remaining {
+		p = p[:lr.remaining]
+	}
+
+	n, err := lr.r.Read(p)
+	lr.remaining -= int64(n)
+	return n, err
+}
+
+// 上限に達した後、続きがあるかを1バイトだけ読んで確かめる
+func (lr *limitedReader) probe() {
+	lr.done = true
+
+	var b [1]byte
+	for {
+		n, err := lr.r.Read(b[:])
+		if n > 0 {
+			lr.truncated = true
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package crawler
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestLimitedReader_Read(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		limit         int64
+		want          string
+		wantTruncated bool
+	}{
+		{name: "上限より短い場合、全て読み込む", body: "hello", limit: 10, want: "hello", wantTruncated: false},
+		{name: "上限ちょうどの場合、全て読み込み打ち切りとはしない", body: "hello", limit: 5, want: "hello", wantTruncated: false},
+		{name: "上限を超える場合、上限まで読み込み打ち切りとする", body: "hello, world", limit: 5, want: "hello", wantTruncated: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newLimitedReader(strings.NewReader(tt.body), tt.limit)
+			got, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatalf("ReadAll() = %v", err)
+			}
+
+			if string(got) != tt.want || r.truncated != tt.wantTruncated {
+				t.Errorf("Read() = (%s, %v), want = (%s, %v)", got, r.truncated, tt.want, tt.wantTruncated)
+			}
+		})
+	}
+}
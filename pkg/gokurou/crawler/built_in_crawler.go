@@ -1,14 +1,16 @@
 package crawler
 
 import (
+	"bufio"
 	"context"
-	"crypto/tls"
+	"fmt"
 	"io"
-	"net"
 	"net/http"
+	"net/http/httptrace"
 	"strings"
 	"time"
 
+	"golang.org/x/text/encoding"
 	"golang.org/x/text/transform"
 
 	"github.com/murakmii/gokurou/pkg/gokurou"
@@ -23,72 +25,149 @@ import (
 )
 
 const (
-	headerUAConfKey    = "built_in.crawler.header_ua"
-	primaryUAConfKey   = "built_in.crawler.primary_ua"
-	secondaryUAConfKey = "built_in.crawler.secondary_ua"
+	// エンコーディングの推測に用いるボディの先頭部分のサイズ
+	sniffingSize = 1024
+
+	headerUAConfKey     = "built_in.crawler.header_ua"
+	primaryUAConfKey    = "built_in.crawler.primary_ua"
+	secondaryUAConfKey  = "built_in.crawler.secondary_ua"
+	extractTextConfKey  = "built_in.crawler.extract_text"
+	dedupConfKey        = "built_in.crawler.dedup"
+	dropDupLinksConfKey = "built_in.crawler.dedup_drop_outlinks"
+	allowedNetsConfKey  = "built_in.crawler.allowed_networks"
+	sendRefererConfKey  = "built_in.crawler.send_referer"
+	linkGraphConfKey    = "built_in.crawler.link_graph"
+	hostStatsConfKey    = "built_in.crawler.host_stats_db_path"
+	cookieJarConfKey    = "built_in.crawler.cookie_jar_db_path"
+	headersConfKey      = "built_in.crawler.headers"
+
+	// URLFrontierと同じ言語のフィルタを用い、フィルタに引っかかるページ自体も成果物に印を付ける
+	languageFilterConfKey = "built_in.url_frontier.language_filter"
 )
 
 type builtInCrawler struct {
 	headerUA         string
 	primaryUA        string
 	secondaryUA      string
+	extractText      bool
+	dedup            bool
+	dropDupLinks     bool
+	sendReferer      bool
+	linkGraph        bool
+	hostStats        *hostStatsStore // ホスト毎の統計情報を記録しない場合はnil
+	cookies          *cookieJar      // Cookieを保持しない場合はnil
+	headers          http.Header     // 全てのリクエストで送信するヘッダー
+	health           *hostHealth     // バックオフしない場合はnil
+	retry            *retryPolicy
+	langFilter       []string // 対象とするページの言語。空なら制限しない
 	defaultRobotsTxt *robots.Txt
-	httpClient       *http.Client
+	httpClients      *httpClientSets
+	sanitizer        *www.Sanitizer // リダイレクト先のURLをサニタイズする
+	proxies          *proxyPool     // プロキシを用いない場合はnil
 }
 
+// 取得の種類
+type fetchType int
+
+const (
+	fetchRobotsTxt fetchType = iota
+	fetchPage
+)
+
 type responseWrapper struct {
-	resp    *http.Response
-	elapsed float64
+	resp     *http.Response
+	elapsed  float64
+	charset  string
+	ip       string         // 接続先のIPアドレス
+	settings *HTTPSettings  // 取得に用いた設定
+	maxSize  int64          // 読み込むボディの最大サイズ。0なら制限しない
+	body     *limitedReader // ボディのサイズを制限していない場合はnil
+	tls      *tlsInfo       // HTTPSでない場合はnil
+	proxy    string         // プロキシを用いなかった場合は空
 }
 
 type artifact struct {
 	Host       string  `json:"host"`
 	URL        string  `json:"url"`
 	StatusCode int     `json:"status"`
+	Protocol   string  `json:"protocol,omitempty"` // "HTTP/1.1"や"HTTP/2.0"等
 	Title      string  `json:"title"`
 	Server     string  `json:"server"`
 	Elapsed    float64 `json:"elapsed"`
+	Charset    string  `json:"charset,omitempty"`
+	Language   string  `json:"language,omitempty"`
+	Text       string  `json:"text,omitempty"`
+	WordCount  int     `json:"word_count,omitempty"`
+	Depth      int     `json:"depth"`
+	Referrer   string  `json:"referrer,omitempty"`
+	Seed       string  `json:"seed,omitempty"`
+	Attempt    int     `json:"attempt,omitempty"`
+
+	// 言語のフィルタに引っかかるページの場合はtrue。タイトルや本文を記録せず、URLも収集しない
+	OtherLanguage bool `json:"other_language,omitempty"`
+
+	// ボディが最大サイズを超えたため、途中までしか解析していない場合はtrue
+	Truncated bool `json:"truncated,omitempty"`
+
+	// 取得に用いたプロキシ。プロキシを用いなかった場合は空
+	Proxy string `json:"proxy,omitempty"`
+
+	// HTTPSで取得した場合のTLSの情報
+	TLS *tlsInfo `json:"tls,omitempty"`
+
+	// 辿ったリダイレクト。リダイレクトしていない場合は空
+	Redirects []*redirectHop `json:"redirects,omitempty"`
+
+	// クロールに失敗した場合(再試行せずに諦めた場合)の情報
+	Error *fetchFailure `json:"error,omitempty"`
+
+	ContentHash   string `json:"content_hash,omitempty"`
+	SimHash       string `json:"simhash,omitempty"`
+	DuplicateOf   string `json:"duplicate_of,omitempty"`
+	NearDuplicate bool   `json:"near_duplicate,omitempty"`
 }
 
-var (
-	// robots.txtを取得する際のリダイレクトのルール
-	// ホスト名ののSDLとTDLが等しい限り、3回までリダイレクトする
-	robotsTxtRedirectPolicy = func(req *http.Request, via []*http.Request) error {
+// robots.txtを取得する際のリダイレクトのルール
+// ホスト名の登録可能なドメイン(eTLD+1)が等しい限り、3回までリダイレクトする
+func robotsTxtRedirectPolicy(sanitizer *www.Sanitizer) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
 		if len(via) >= 3 {
 			return http.ErrUseLastResponse
 		}
 
-		first, err := www.SanitizedURLFromURL(via[0].URL)
+		first, err := sanitizer.FromURL(via[0].URL)
 		if err != nil {
 			return http.ErrUseLastResponse
 		}
 
-		next, err := www.SanitizedURLFromURL(req.URL)
+		next, err := sanitizer.FromURL(req.URL)
 		if err != nil {
 			return http.ErrUseLastResponse
 		}
 
-		if !strings.HasSuffix(next.Host(), first.Host()) {
+		if next.RegistrableDomain() != first.RegistrableDomain() {
 			return http.ErrUseLastResponse
 		}
 
 		gokurou.LoggerFromContext(req.Context()).Debugf("redirecting: %s", req.URL)
 		return nil
 	}
+}
 
-	// ページを取得する際のリダイレクトのルール
-	// ホスト名が等しい限り3回までリダイレクトする
-	pageRedirectPolicy = func(req *http.Request, via []*http.Request) error {
+// ページを取得する際のリダイレクトのルール
+// ホスト名が等しい限り3回までリダイレクトする。別のホストへのリダイレクトはクロールの際にURLとして収集する
+func pageRedirectPolicy(sanitizer *www.Sanitizer) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
 		if len(via) >= 3 {
 			return http.ErrUseLastResponse
 		}
 
-		before, err := www.SanitizedURLFromURL(via[len(via)-1].URL)
+		before, err := sanitizer.FromURL(via[len(via)-1].URL)
 		if err != nil {
 			return http.ErrUseLastResponse
 		}
 
-		next, err := www.SanitizedURLFromURL(req.URL)
+		next, err := sanitizer.FromURL(req.URL)
 		if err != nil {
 			return http.ErrUseLastResponse
 		}
@@ -100,70 +179,174 @@ var (
 		gokurou.LoggerFromContext(req.Context()).Debugf("redirecting: %s", req.URL)
 		return nil
 	}
-)
+}
+
+// 設定から全てのリクエストで送信するヘッダーを生成する
+func defaultHeaders(conf *gokurou.Configuration) (http.Header, error) {
+	headers := make(http.Header)
+
+	option, exists := conf.Options[headersConfKey]
+	if !exists || option == nil {
+		return headers, nil
+	}
+
+	values, ok := option.(map[string]string)
+	if !ok {
+		return nil, xerrors.Errorf("'%s' config expects value as map[string]string", headersConfKey)
+	}
+
+	for name, value := range values {
+		headers.Set(name, value)
+	}
+	return headers, nil
+}
 
 // Crawlerを生成して返す
-func BuiltInCrawlerProvider(_ context.Context, conf *gokurou.Configuration) (gokurou.Crawler, error) {
+func BuiltInCrawlerProvider(ctx context.Context, conf *gokurou.Configuration) (gokurou.Crawler, error) {
+	allowedNets, err := conf.OptionAsStrings(allowedNetsConfKey)
+	if err != nil {
+		return nil, err
+	}
+
+	guard, err := newNetworkGuard(allowedNets)
+	if err != nil {
+		return nil, err
+	}
+
+	var hostStats *hostStatsStore
+	if path := conf.OptionAsString(hostStatsConfKey); path != nil && len(*path) > 0 {
+		if hostStats, err = openHostStatsStore(fmt.Sprintf(*path, gokurou.GWNFromContext(ctx))); err != nil {
+			return nil, err
+		}
+	}
+
+	headers, err := defaultHeaders(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	langFilter, err := conf.OptionAsStrings(languageFilterConfKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// CookieJarはインターフェースなので、保持しない場合はnilのままにしておく
+	var cookies *cookieJar
+	var jar http.CookieJar
+	if path := conf.OptionAsString(cookieJarConfKey); path != nil && len(*path) > 0 {
+		if cookies, err = openCookieJar(fmt.Sprintf(*path, gokurou.GWNFromContext(ctx))); err != nil {
+			return nil, err
+		}
+		jar = cookies
+	}
+
+	proxies, err := newProxyPool(conf, gokurou.GWNFromContext(ctx), guard)
+	if err != nil {
+		return nil, err
+	}
+
+	sanitizer := conf.Sanitizer()
+	httpClients, err := newHTTPClientSets(conf, sanitizer, guard, proxies, jar)
+	if err != nil {
+		return nil, err
+	}
+
+	if proxies != nil {
+		proxies.start()
+	}
+
 	return &builtInCrawler{
-		headerUA:    conf.MustOptionAsString(headerUAConfKey),
-		primaryUA:   conf.MustOptionAsString(primaryUAConfKey),
-		secondaryUA: conf.MustOptionAsString(secondaryUAConfKey),
-		httpClient: &http.Client{
-			Transport: &http.Transport{
-				MaxIdleConns:          1,
-				MaxIdleConnsPerHost:   1,
-				MaxConnsPerHost:       2,
-				DisableCompression:    false,
-				ResponseHeaderTimeout: 3 * time.Second,
-				DialContext: (&net.Dialer{
-					Timeout: 3 * time.Second,
-				}).DialContext,
-				TLSClientConfig: &tls.Config{
-					MinVersion: tls.VersionSSL30, // SSL 3.0もサポートする
-					MaxVersion: tls.VersionTLS13,
-				},
-
-				// ESTABLISHEDなsocketの数に如実に影響するので短めに設定する
-				// robots.txt取得後のページ取得まで生きていれば良い
-				IdleConnTimeout: 1 * time.Second,
-			},
-			CheckRedirect: nil,
-			Timeout:       5 * time.Second,
-		},
+		headerUA:     conf.MustOptionAsString(headerUAConfKey),
+		primaryUA:    conf.MustOptionAsString(primaryUAConfKey),
+		secondaryUA:  conf.MustOptionAsString(secondaryUAConfKey),
+		extractText:  conf.OptionAsBool(extractTextConfKey),
+		dedup:        conf.OptionAsBool(dedupConfKey),
+		dropDupLinks: conf.OptionAsBool(dropDupLinksConfKey),
+		sendReferer:  conf.OptionAsBool(sendRefererConfKey),
+		linkGraph:    conf.OptionAsBool(linkGraphConfKey),
+		hostStats:    hostStats,
+		health:       newHostHealth(conf),
+		retry:        newRetryPolicy(conf),
+		langFilter:   langFilter,
+		httpClients:  httpClients,
+		sanitizer:    sanitizer,
+		proxies:      proxies,
+		cookies:      cookies,
+		headers:      headers,
 	}, nil
 }
 
-func (crawler *builtInCrawler) Crawl(ctx context.Context, url *www.SanitizedURL, out gokurou.OutputPipeline) error {
+func (crawler *builtInCrawler) Crawl(ctx context.Context, popped *gokurou.PoppedURL, out gokurou.OutputPipeline) error {
+	url := popped.URL
 	logger := gokurou.LoggerFromContext(ctx)
 	defer func() {
 		logger.Debug("finished")
 	}()
 
-	robotsTxt, err := crawler.getRobotsTxt(ctx, url)
+	if popped.LockFailed {
+		logger.Debugf("skip crawling host which can't be locked: %s", url.Host())
+		art := newArtifact(popped)
+		art.Error = &fetchFailure{Class: reasonLocked, Phase: phaseRobots}
+		out.OutputArtifact(ctx, art)
+		return nil
+	}
+
+	if crawler.health != nil && !crawler.health.available(url.Host()) {
+		// 再試行中のURLは、バックオフが終わった後に改めて再試行する
+		if wait := crawler.health.waiting(url.Host()); popped.Attempt > 0 && wait > 0 {
+			out.OutputRetryURL(ctx, &gokurou.RetryURL{Popped: popped, Delay: wait})
+			return nil
+		}
+
+		// それ以外はrobots.txtの取得前に諦めたものとして記録する
+		logger.Debugf("skip crawling unhealthy host: %s", url.Host())
+		art := newArtifact(popped)
+		art.Error = &fetchFailure{Class: reasonBackoff, Phase: phaseRobots}
+		out.OutputArtifact(ctx, art)
+		return nil
+	}
+
+	record := &crawlRecord{}
+	defer crawler.saveCrawlRecord(ctx, url, record)
+
+	robotsTxt, err := crawler.getRobotsTxt(ctx, url, record)
 	if err != nil {
-		if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+		if !isTimeout(err) {
 			logger.Warnf("failed to crawl: %v", err)
 		}
 
+		crawler.handleFetchError(ctx, popped, out, err, phaseRobots)
 		return nil // robots.txtがエラーになるならどうせページ取得もエラーになるので中断する
 	}
 
+	if record.throttled {
+		logger.Debugf("throttled on robots.txt: %s", url.Host())
+		art := newArtifact(popped)
+		if !crawler.retryOrGiveUp(ctx, popped, out, art, &fetchFailure{Class: reasonThrottled, Phase: phaseRobots}, true) {
+			out.OutputArtifact(ctx, art)
+		}
+		return nil
+	}
+
 	if robotsTxt != nil && !robotsTxt.Allows(url.Path()) {
 		logger.Debugf("crawling disallowed by robots.txt: %s", url)
+		art := newArtifact(popped)
+		art.Error = &fetchFailure{Class: reasonDisallowed, Phase: phaseRobots}
+		out.OutputArtifact(ctx, art)
 		return nil
 	}
 
-	resp, err := crawler.request(ctx, url, pageRedirectPolicy)
+	resp, err := crawler.request(ctx, url, crawler.refererFor(popped), fetchPage)
 
 	defer func() {
-		if err != nil {
-			if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
-				logger.Warnf("failed to crawl: %v", err)
-			}
+		if err != nil && !isTimeout(err) {
+			logger.Warnf("failed to crawl: %v", err)
 		}
 	}()
 
 	if err != nil {
+		record.errors++
+		crawler.handleFetchError(ctx, popped, out, err, "")
 		return nil
 	}
 
@@ -171,12 +354,28 @@ func (crawler *builtInCrawler) Crawl(ctx context.Context, url *www.SanitizedURL,
 		err = resp.resp.Body.Close()
 	}()
 
-	baseArtifact := &artifact{
-		Host:       url.Host(),
-		URL:        url.String(),
-		StatusCode: resp.resp.StatusCode,
-		Server:     resp.resp.Header.Get("Server"),
-		Elapsed:    resp.elapsed,
+	record.fetched = true
+	record.elapsed = resp.elapsed
+	record.server = resp.resp.Header.Get("Server")
+	record.ip = resp.ip
+	record.observeThrottling(resp.resp)
+	if resp.resp.StatusCode >= 500 {
+		record.errors++
+	}
+
+	baseArtifact := newArtifact(popped)
+	baseArtifact.StatusCode = resp.resp.StatusCode
+	baseArtifact.Protocol = resp.resp.Proto
+	baseArtifact.TLS = resp.tls
+	baseArtifact.Proxy = resp.proxy
+	baseArtifact.Server = resp.resp.Header.Get("Server")
+	baseArtifact.Elapsed = resp.elapsed
+	baseArtifact.Redirects = redirectChain(resp.resp)
+
+	// 5xxの場合は、再試行するなら成果物は再試行の結果に任せる
+	failure := &fetchFailure{Class: reasonHTTP5xx, Phase: phaseResponse}
+	if resp.resp.StatusCode >= 500 && crawler.retryOrGiveUp(ctx, popped, out, baseArtifact, failure, true) {
+		return nil
 	}
 
 	defer func() {
@@ -185,61 +384,254 @@ func (crawler *builtInCrawler) Crawl(ctx context.Context, url *www.SanitizedURL,
 		}
 	}()
 
+	// 別のホストへのリダイレクトは、リダイレクト先を新たなURLとして収集し、ボディは解析しない
+	if target := crossHostRedirectTarget(resp.resp, crawler.sanitizer); target != nil {
+		out.OutputCollectedURL(ctx, &gokurou.SpawnedURL{
+			From:    url,
+			Depth:   popped.Depth,
+			Seed:    popped.Seed,
+			Elapsed: resp.elapsed,
+			Spawned: []*www.SanitizedURL{target},
+		})
+		return nil
+	}
+
 	if !resp.parsableText() {
 		return nil
 	}
 
 	page, err := www.ParseHTML(resp.bodyReader(), url)
 	if err != nil {
+		reason, _ := classifyError(err)
+		baseArtifact.Error = &fetchFailure{Class: reason, Phase: phaseBody, Message: err.Error()}
+		return nil
+	}
+
+	language := resp.language(page)
+	baseArtifact.Truncated = resp.truncated()
+	baseArtifact.Charset = resp.charset
+	baseArtifact.Language = language
+
+	if !www.AcceptsLanguage(crawler.langFilter, language) {
+		logger.Debugf("skip page in filtered language(%s): %s", language, url)
+		baseArtifact.OtherLanguage = true
 		return nil
 	}
 
+	if crawler.linkGraph && len(page.Links()) > 0 {
+		out.OutputArtifact(ctx, &gokurou.OutLinks{From: url, Links: page.Links()})
+	}
+
+	duplicated := crawler.markDuplicate(ctx, baseArtifact, page)
+
 	if page.NoIndex() {
 		baseArtifact = nil
 	} else {
 		baseArtifact.Title = page.Title()
+		if crawler.extractText {
+			baseArtifact.Text = page.MainText()
+			baseArtifact.WordCount = page.WordCount()
+		}
+	}
+
+	if duplicated && crawler.dropDupLinks {
+		logger.Debugf("skip collecting urls from duplicated page: %s", url)
+		return nil
 	}
 
 	out.OutputCollectedURL(ctx, &gokurou.SpawnedURL{
-		From:    url,
-		Elapsed: resp.elapsed,
-		Spawned: page.AllURL(),
+		From:     url,
+		Depth:    popped.Depth,
+		Seed:     popped.Seed,
+		Elapsed:  resp.elapsed,
+		Language: language,
+		Spawned:  page.AllURL(),
 	})
 
 	return nil
 }
 
 func (crawler *builtInCrawler) Finish() error {
-	crawler.httpClient.CloseIdleConnections()
+	crawler.httpClients.closeIdleConnections()
+	if crawler.proxies != nil {
+		crawler.proxies.close()
+	}
+
+	if crawler.cookies != nil {
+		if err := crawler.cookies.close(); err != nil {
+			return err
+		}
+	}
+
+	if crawler.hostStats != nil {
+		return crawler.hostStats.close()
+	}
 	return nil
 }
 
+// クロールで得られた情報をホスト毎の統計情報と健全性に反映する
+// 失敗してもクロールそのものには影響しないため、警告するだけでクロールは継続する
+func (crawler *builtInCrawler) saveCrawlRecord(ctx context.Context, url *www.SanitizedURL, record *crawlRecord) {
+	logger := gokurou.LoggerFromContext(ctx)
+
+	if crawler.hostStats != nil {
+		if err := crawler.hostStats.update(url.Host(), record.apply); err != nil {
+			logger.Warnf("failed to save host stats: %v", err)
+		}
+	}
+
+	if crawler.health == nil {
+		return
+	}
+
+	// バックオフする間は他のworkerもアクセスしないよう、IPアドレスのロックを延長する
+	backoff := crawler.health.observe(url.Host(), record)
+	if backoff <= 0 {
+		return
+	}
+
+	logger.Debugf("backoff %s for %s", backoff, url.Host())
+	if err := gokurou.CoordinatorFromContext(ctx).ExtendLockByIPAddrOf(url.Hostname(), backoff); err != nil {
+		logger.Warnf("failed to extend lock: %v", err)
+	}
+}
+
+// クロール対象のURLについての成果物を生成する
+func newArtifact(popped *gokurou.PoppedURL) *artifact {
+	art := &artifact{
+		Host:    popped.URL.Host(),
+		URL:     popped.URL.String(),
+		Depth:   popped.Depth,
+		Attempt: popped.Attempt,
+	}
+
+	if popped.Referrer != nil {
+		art.Referrer = popped.Referrer.String()
+	}
+
+	if popped.Seed != nil {
+		art.Seed = popped.Seed.String()
+	}
+
+	return art
+}
+
+// 取得時のエラーによるクロールの失敗を処理する
+// 再試行しない場合は、失敗した段階とエラーの分類を成果物として出力する
+// phaseが空の場合は、リクエストが失敗した段階を用いる
+func (crawler *builtInCrawler) handleFetchError(ctx context.Context, popped *gokurou.PoppedURL, out gokurou.OutputPipeline, err error, phase fetchPhase) {
+	reason, transient := classifyError(err)
+	art := newArtifact(popped)
+
+	var reqErr *requestError
+	if xerrors.As(err, &reqErr) {
+		art.Elapsed = reqErr.elapsed
+		if reqErr.proxy != nil {
+			art.Proxy = proxyName(reqErr.proxy)
+		}
+		if len(phase) == 0 {
+			phase = reqErr.phase
+		}
+	}
+
+	failure := &fetchFailure{Class: reason, Phase: phase, Message: err.Error()}
+	if !crawler.retryOrGiveUp(ctx, popped, out, art, failure, transient) {
+		out.OutputArtifact(ctx, art)
+	}
+}
+
+// 一時的な失敗であれば再試行してtrueを返す
+// 再試行しない場合は失敗の情報を成果物に記録し、falseを返す
+func (crawler *builtInCrawler) retryOrGiveUp(ctx context.Context, popped *gokurou.PoppedURL, out gokurou.OutputPipeline, art *artifact, failure *fetchFailure, transient bool) bool {
+	if retry := crawler.retry.retryOf(popped, transient); retry != nil {
+		gokurou.LoggerFromContext(ctx).Debugf("retry(%d) after %s by %s: %s", retry.Popped.Attempt, retry.Delay, failure.Class, popped.URL)
+		out.OutputRetryURL(ctx, retry)
+		return true
+	}
+
+	art.Error = failure
+	return false
+}
+
+// Refererヘッダーとして送信するURLを返す。送信しない場合はnilを返す
+// ブラウザと同様に、HTTPSのページからHTTPのページへのリンクでは送信しない
+func (crawler *builtInCrawler) refererFor(popped *gokurou.PoppedURL) *www.SanitizedURL {
+	if !crawler.sendReferer || popped.Referrer == nil {
+		return nil
+	}
+
+	if strings.HasPrefix(popped.Referrer.String(), "https:") && strings.HasPrefix(popped.URL.String(), "http:") {
+		return nil
+	}
+
+	return popped.Referrer
+}
+
+// 本文のハッシュ値とSimHashを成果物に記録し、他のページと内容が重複していればそれも記録する
+// 本文が空のページは重複の判定を行わない
+// 重複の判定は必須ではないため、判定に失敗した場合は重複していないものとして扱う
+func (crawler *builtInCrawler) markDuplicate(ctx context.Context, art *artifact, page *www.Page) bool {
+	text := page.MainText()
+	if len(text) == 0 {
+		return false
+	}
+
+	simHash := www.SimHash(text)
+	art.ContentHash = www.ContentHash(text)
+	art.SimHash = fmt.Sprintf("%016x", simHash)
+
+	if !crawler.dedup {
+		return false
+	}
+
+	dup, err := gokurou.CoordinatorFromContext(ctx).FindDuplicateContent(art.URL, art.ContentHash, simHash)
+	if err != nil {
+		gokurou.LoggerFromContext(ctx).Warnf("failed to find duplicate content: %v", err)
+		return false
+	}
+
+	if dup == nil {
+		return false
+	}
+
+	art.DuplicateOf = dup.URL
+	art.NearDuplicate = dup.Near
+	return true
+}
+
 // robots.txtを取得する
 // このメソッドはエラーを返さず、意図したrobots.txtが取得できないならデフォルトのそれを返す
-func (crawler *builtInCrawler) getRobotsTxt(ctx context.Context, url *www.SanitizedURL) (*robots.Txt, error) {
-	resp, err := crawler.request(ctx, url.RobotsTxtURL(), robotsTxtRedirectPolicy)
+func (crawler *builtInCrawler) getRobotsTxt(ctx context.Context, url *www.SanitizedURL, record *crawlRecord) (*robots.Txt, error) {
+	resp, err := crawler.request(ctx, url.RobotsTxtURL(), nil, fetchRobotsTxt)
 	defer func() {
-		if err != nil {
-			if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
-				gokurou.LoggerFromContext(ctx).Warnf("failed to get robots.txt: %v", err)
-			}
+		if err != nil && !isTimeout(err) {
+			gokurou.LoggerFromContext(ctx).Warnf("failed to get robots.txt: %v", err)
 		}
 	}()
 
 	if err != nil {
+		record.errors++
 		return nil, err
 	}
 
 	defer resp.resp.Body.Close()
 
+	record.robotsStatus = resp.resp.StatusCode
+	record.ip = resp.ip
+	record.observeThrottling(resp.resp)
 	if !resp.parsableText() {
 		return nil, nil
 	}
 
-	return robots.ParserRobotsTxt(resp.bodyReader(), crawler.primaryUA, crawler.secondaryUA)
+	txt, err := robots.ParserRobotsTxt(resp.bodyReader(), crawler.primaryUA, crawler.secondaryUA)
+	if txt != nil {
+		record.crawlDelay = txt.Delay()
+	}
+	return txt, err
 }
 
-func (crawler *builtInCrawler) request(ctx context.Context, url *www.SanitizedURL, redirectPolicy func(req *http.Request, via []*http.Request) error) (*responseWrapper, error) {
+// refererがnilでない場合はRefererヘッダーとして送信する
+func (crawler *builtInCrawler) request(ctx context.Context, url *www.SanitizedURL, referer *www.SanitizedURL, typ fetchType) (*responseWrapper, error) {
 	gokurou.LoggerFromContext(ctx).Debugf("preparing: %s", url)
 
 	req, err := http.NewRequest("GET", url.String(), nil)
@@ -247,37 +639,118 @@ func (crawler *builtInCrawler) request(ctx context.Context, url *www.SanitizedUR
 		return nil, xerrors.Errorf("failed to build request for: %w", err)
 	}
 
-	req = req.WithContext(ctx)
+	// プロキシを用いる場合は、Transportが取り出せるようコンテキストに含める
+	proxy, err := crawler.proxies.pick()
+	if err != nil {
+		return nil, &requestError{err: err, phase: phaseConnect}
+	}
+
+	if proxy != nil {
+		ctx = withProxy(ctx, proxy)
+	}
+
+	// 失敗した段階と接続先のIPアドレスを記録する
+	progress := newFetchProgress()
+	req = req.WithContext(httptrace.WithClientTrace(ctx, progress.clientTrace()))
+	// User-Agent等のクローラーが決めるヘッダーは、設定されたヘッダーより優先する
+	for name, values := range crawler.headers {
+		req.Header[name] = values
+	}
 	req.Header.Set("User-Agent", crawler.headerUA)
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	if referer != nil {
+		req.Header.Set("Referer", referer.String())
+	}
+
+	clients := crawler.httpClients.forHost(url.Hostname())
 
-	crawler.httpClient.CheckRedirect = redirectPolicy
 	start := time.Now()
-	resp, err := crawler.httpClient.Do(req)
+	resp, err := clients.clients[typ].Do(req)
 	elapsed := time.Since(start).Seconds()
 	gokurou.TracerFromContext(ctx).TraceGetRequest(ctx, elapsed)
 
+	phase, ip := progress.current()
 	if err != nil {
-		return nil, err
+		// 接続に失敗したプロキシは、ヘルスチェックで復帰するまで用いない
+		if proxy != nil && isProxyFailure(err) {
+			crawler.proxies.markUnhealthy(proxy)
+		}
+		return nil, &requestError{err: err, phase: phase, elapsed: elapsed, proxy: proxy}
+	}
+
+	decodeContent(resp)
+
+	wrapper := &responseWrapper{
+		resp:     resp,
+		elapsed:  elapsed,
+		ip:       ip,
+		settings: clients.settings,
+		maxSize:  clients.settings.maxSizeOf(typ),
+		tls:      tlsInfoOf(resp.TLS, clients.transport.TLSClientConfig),
 	}
 
-	return &responseWrapper{resp: resp, elapsed: elapsed}, nil
+	if proxy != nil {
+		wrapper.proxy = proxyName(proxy)
+	}
+	return wrapper, nil
 }
 
 func (rw *responseWrapper) bodyReader() io.Reader {
-	// Content-Typeのみでエンコーディングを推測し、無理ならそのままにする
-	src := rw.resp.Body
-	enc, _, certain := charset.DetermineEncoding(make([]byte, 0), rw.resp.Header.Get("Content-Type"))
-	if !certain {
+	// BOM, Content-Type, <meta>の順にボディ先頭の1KBからエンコーディングを推測し、無理ならそのままにする
+	// 推測できたエンコーディング名はcharsetに記録しておく
+	var body io.Reader = rw.resp.Body
+	if rw.maxSize > 0 {
+		rw.body = newLimitedReader(body, rw.maxSize)
+		body = rw.body
+	}
+
+	src := bufio.NewReaderSize(body, sniffingSize)
+	head, _ := src.Peek(sniffingSize)
+
+	enc, name := determineEncoding(head, rw.resp.Header.Get("Content-Type"))
+	rw.charset = name
+	if enc == nil || enc == encoding.Nop {
 		return src
 	}
 	return transform.NewReader(src, enc.NewDecoder())
 }
 
-func (rw *responseWrapper) parsableText() bool {
-	ct := rw.resp.Header.Get("Content-Type")
+// ボディが最大サイズを超えたため、途中で読み込みを打ち切ったならtrueを返す
+func (rw *responseWrapper) truncated() bool {
+	return rw.body != nil && rw.body.truncated
+}
+
+// ページの言語を<html lang>, Content-Language, 本文の内容の順に調べて返す
+func (rw *responseWrapper) language(page *www.Page) string {
+	if lang := page.Language(); len(lang) > 0 {
+		return lang
+	}
+
+	if lang := www.NormalizeLanguageTag(rw.resp.Header.Get("Content-Language")); len(lang) > 0 {
+		return lang
+	}
+
+	if text := page.MainText(); len(text) > 0 {
+		return www.DetectLanguage(text)
+	}
+
+	return www.DetectLanguage(page.Title())
+}
+
+// ボディの先頭部分とContent-Typeから文字エンコーディングを推測する
+// どこにも宣言がなく推測もできなかった場合はnilを返す
+func determineEncoding(head []byte, contentType string) (encoding.Encoding, string) {
+	enc, name, certain := charset.DetermineEncoding(head, contentType)
 
-	return len(ct) == 0 ||
-		strings.Contains(ct, "text") ||
-		strings.Contains(ct, "html") ||
-		strings.Contains(ct, "xml")
+	// 宣言がない場合、DetermineEncodingはUTF-8として妥当ならutf-8を、そうでなければwindows-1252を仮定して返す
+	// <meta>でwindows-1252と宣言された場合とは区別できないため、BOMかContent-Typeによるもの以外は仮定されたものとして信用しない
+	if certain || name != "windows-1252" {
+		return enc, name
+	}
+
+	return nil, ""
+}
+
+func (rw *responseWrapper) parsableText() bool {
+	return rw.settings.accepts(rw.resp.Header.Get("Content-Type"))
 }
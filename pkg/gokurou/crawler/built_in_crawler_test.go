@@ -2,19 +2,32 @@ package crawler
 
 import (
 	"context"
+	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/murakmii/gokurou/pkg/gokurou"
 
 	"github.com/murakmii/gokurou/pkg/gokurou/www"
+
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/xerrors"
 )
 
 type mockPipeline struct {
 	pushed    []*gokurou.SpawnedURL
 	collected []*artifact
+	outLinks  []*gokurou.OutLinks
+	retried   []*gokurou.RetryURL
 }
 
 func buildMockPipeline() *mockPipeline {
@@ -25,6 +38,10 @@ func buildMockPipeline() *mockPipeline {
 }
 
 func (p *mockPipeline) OutputArtifact(ctx context.Context, a interface{}) {
+	if outLinks, ok := a.(*gokurou.OutLinks); ok {
+		p.outLinks = append(p.outLinks, outLinks)
+		return
+	}
 	p.collected = append(p.collected, a.(*artifact))
 }
 
@@ -32,14 +49,54 @@ func (p *mockPipeline) OutputCollectedURL(ctx context.Context, spawned *gokurou.
 	p.pushed = append(p.pushed, spawned)
 }
 
+func (p *mockPipeline) OutputRetryURL(ctx context.Context, retry *gokurou.RetryURL) {
+	p.retried = append(p.retried, retry)
+}
+
+// 本文のハッシュ値のみで重複を判定するCoordinatorのモック
+// ロックの延長は要求された時間を記録するだけ
+type mockCoordinator struct {
+	hashes   map[string]string
+	extended map[string]time.Duration
+	dedupErr error // 設定されている場合、FindDuplicateContentはこれを返す
+}
+
+func (c *mockCoordinator) AllocNextGWN() (uint16, error)         { return 1, nil }
+func (c *mockCoordinator) LockByIPAddrOf(_ string) (bool, error) { return true, nil }
+func (c *mockCoordinator) Finish() error                         { return nil }
+func (c *mockCoordinator) Reset() error                          { return nil }
+
+func (c *mockCoordinator) ExtendLockByIPAddrOf(host string, ttl time.Duration) error {
+	c.extended[host] = ttl
+	return nil
+}
+
+func (c *mockCoordinator) FindDuplicateContent(url string, contentHash string, _ uint64) (*gokurou.DuplicateContent, error) {
+	if c.dedupErr != nil {
+		return nil, c.dedupErr
+	}
+
+	if dupURL, ok := c.hashes[contentHash]; ok {
+		return &gokurou.DuplicateContent{URL: dupURL}, nil
+	}
+
+	c.hashes[contentHash] = url
+	return nil, nil
+}
+
 func buildConfiguration() *gokurou.Configuration {
 	conf := gokurou.NewConfiguration(1, 1)
+	conf.PortPolicy = &www.PortPolicy{Mode: www.AllowAllPorts} // テストサーバーはランダムなポートで起動する
 	conf.Options["built_in.crawler.header_ua"] = "test"
 	conf.Options["built_in.crawler.primary_ua"] = "gokurou"
 	conf.Options["built_in.crawler.secondary_ua"] = "google"
+	conf.Options["built_in.crawler.allowed_networks"] = []string{"127.0.0.1/32"} // テストサーバーはループバックアドレスで起動する
 	return conf
 }
 
+// テストサーバーのURLをサニタイズする
+var testSanitizer = buildConfiguration().Sanitizer()
+
 func buildTestServer() *httptest.Server {
 	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.URL.Path {
@@ -56,10 +113,76 @@ func buildTestServer() *httptest.Server {
 			_, _ = w.Write([]byte("<a href='http://www.example.com/foobar.html'>"))
 			_, _ = w.Write([]byte("<a href='http://www.example.com/hogefuga.html'>"))
 
+		case "/article.html":
+			w.Header().Set("Server", "test-server")
+			w.Header().Set("Content-Language", "en-US")
+			_, _ = w.Write([]byte("<nav><a href='/'>Top</a></nav>"))
+			_, _ = w.Write([]byte("<p>This is an article for testing main text extraction.</p>"))
+
+		case "/sjis.html":
+			body, _ := japanese.ShiftJIS.NewEncoder().String("<meta charset='Shift_JIS'><title>こんにちは、クローラー</title>")
+			w.Header().Set("Server", "test-server")
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(body))
+
+		case "/mirror1.html", "/mirror2.html":
+			w.Header().Set("Server", "test-server")
+			_, _ = w.Write([]byte("<p>This article is mirrored on many sites.</p><a href='http://www.example.com/'>"))
+
+		case "/referer.html":
+			w.Header().Set("Server", "test-server")
+			_, _ = w.Write([]byte("<title>" + r.Header.Get("Referer") + "</title>"))
+			_, _ = w.Write([]byte("<a href='http://www.example.com/'>"))
+
+		case "/error.html":
+			w.Header().Set("Server", "test-server")
+			w.WriteHeader(http.StatusInternalServerError)
+
+		case "/throttled.html":
+			w.Header().Set("Server", "test-server")
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusTooManyRequests)
+
+		case "/large.html":
+			w.Header().Set("Server", "test-server")
+			_, _ = w.Write([]byte("<title>Large page</title><a href='http://www.example.com/head.html'>"))
+			_, _ = w.Write([]byte(strings.Repeat("<p>padding</p>", 1000)))
+			_, _ = w.Write([]byte("<a href='http://www.example.com/tail.html'>"))
+
+		case "/brotli.html":
+			w.Header().Set("Server", "test-server")
+			w.Header().Set("Content-Encoding", "br")
+			_, _ = w.Write(compress("br", "<title>"+r.Header.Get("Accept-Encoding")+"</title>"))
+
+		case "/headers.html":
+			w.Header().Set("Server", "test-server")
+			_, _ = w.Write([]byte("<title>" + r.Header.Get("Accept-Language") + "|" + r.Header.Get("From") + "|" + r.Header.Get("User-Agent") + "</title>"))
+
+		case "/consent.html":
+			w.Header().Set("Server", "test-server")
+			if cookie, err := r.Cookie("consent"); err == nil && cookie.Value == "yes" {
+				_, _ = w.Write([]byte("<title>Welcome</title>"))
+				return
+			}
+
+			http.SetCookie(w, &http.Cookie{Name: "consent", Value: "yes", Path: "/"})
+			_, _ = w.Write([]byte("<title>Consent required</title>"))
+
 		case "/noindex.html":
 			w.Header().Set("Server", "test-server")
 			_, _ = w.Write([]byte("<meta name='robots' content='noindex' />"))
 
+		case "/moved":
+			w.Header().Set("Server", "test-server")
+			w.Header().Set("Location", "/moved-again")
+			w.WriteHeader(http.StatusFound)
+
+		case "/moved-again":
+			w.Header().Set("Server", "test-server")
+			w.Header().Set("Location", "http://www.example.com/moved")
+			w.WriteHeader(http.StatusMovedPermanently)
+			_, _ = w.Write([]byte("<a href='http://www.example.org/'>"))
+
 		case "/redirect":
 			w.Header().Set("Server", "test-server")
 			w.Header().Set("Location", "/redirect")
@@ -105,9 +228,9 @@ func TestDefaultCrawler_Crawl(t *testing.T) {
 
 	t.Run("問題なくクロールできる場合、結果を収集する", func(t *testing.T) {
 		out := buildMockPipeline()
-		url, _ := www.SanitizedURLFromString(ts.URL + "/index.html")
+		url, _ := testSanitizer.FromString(ts.URL + "/index.html")
 
-		err := crawler.Crawl(ctx, url, out)
+		err := crawler.Crawl(ctx, &gokurou.PoppedURL{URL: url}, out)
 		if err != nil {
 			t.Errorf("Crawl() = %v", err)
 		}
@@ -131,11 +254,401 @@ func TestDefaultCrawler_Crawl(t *testing.T) {
 		}
 	})
 
+	t.Run("ループバックアドレスへのアクセスが許可されていない場合、クロールせずに失敗を記録する", func(t *testing.T) {
+		conf := buildConfiguration()
+		delete(conf.Options, "built_in.crawler.allowed_networks")
+		crawler, err := BuiltInCrawlerProvider(ctx, conf)
+		if err != nil {
+			panic(err)
+		}
+
+		out := buildMockPipeline()
+		url, _ := testSanitizer.FromString(ts.URL + "/index.html")
+
+		err = crawler.Crawl(ctx, &gokurou.PoppedURL{URL: url}, out)
+		if err != nil {
+			t.Errorf("Crawl() = %v", err)
+		}
+
+		if len(out.pushed) != 0 {
+			t.Errorf("Crawl() accessed to loopback address")
+		}
+
+		assertFailure(t, out, "blocked", "robots")
+	})
+
+	t.Run("深さ、参照元、初期URLを成果物と収集したURLに引き継ぐ", func(t *testing.T) {
+		conf := buildConfiguration()
+		conf.Options["built_in.crawler.send_referer"] = true
+		crawler, err := BuiltInCrawlerProvider(ctx, conf)
+		if err != nil {
+			panic(err)
+		}
+
+		out := buildMockPipeline()
+		url, _ := testSanitizer.FromString(ts.URL + "/referer.html")
+		referrer, _ := testSanitizer.FromString(ts.URL + "/index.html")
+		seed, _ := testSanitizer.FromString(ts.URL + "/")
+
+		err = crawler.Crawl(ctx, &gokurou.PoppedURL{URL: url, Depth: 2, Referrer: referrer, Seed: seed}, out)
+		if err != nil {
+			t.Errorf("Crawl() = %v", err)
+		}
+
+		if len(out.collected) != 1 {
+			t.Errorf("Crawl() does NOT collect artifact")
+			return
+		}
+
+		art := out.collected[0]
+		if art.Depth != 2 || art.Referrer != referrer.String() || art.Seed != seed.String() {
+			t.Errorf("Crawl() collected invalid artifact(depth = %d, referrer = %s, seed = %s)", art.Depth, art.Referrer, art.Seed)
+		}
+
+		if art.Title != referrer.String() {
+			t.Errorf("Crawl() does NOT send referer(title = %s)", art.Title)
+		}
+
+		if len(out.pushed) != 1 || out.pushed[0].Depth != 2 || out.pushed[0].Seed.String() != seed.String() {
+			t.Errorf("Crawl() collected urls without depth and seed")
+		}
+	})
+
+	t.Run("言語のフィルタに引っかかるページの場合、印を付けた成果物だけを記録してURLを収集しない", func(t *testing.T) {
+		conf := buildConfiguration()
+		conf.Options["built_in.url_frontier.language_filter"] = []string{"ja"}
+		conf.Options["built_in.crawler.link_graph"] = true
+		crawler, err := BuiltInCrawlerProvider(ctx, conf)
+		if err != nil {
+			panic(err)
+		}
+
+		out := buildMockPipeline()
+		url, _ := testSanitizer.FromString(ts.URL + "/article.html")
+
+		err = crawler.Crawl(ctx, &gokurou.PoppedURL{URL: url}, out)
+		if err != nil {
+			t.Errorf("Crawl() = %v", err)
+		}
+
+		if len(out.collected) != 1 {
+			t.Errorf("Crawl() does NOT collect artifact")
+			return
+		}
+
+		art := out.collected[0]
+		if !art.OtherLanguage || art.Language != "en" || len(art.Title) > 0 || len(art.Text) > 0 {
+			t.Errorf("Crawl() collected invalid artifact(other_language = %v, language = %s, title = %s, text = %s)", art.OtherLanguage, art.Language, art.Title, art.Text)
+		}
+
+		if len(out.pushed) != 0 || len(out.outLinks) != 0 {
+			t.Errorf("Crawl() collected urls from page in filtered language")
+		}
+	})
+
+	t.Run("リンクグラフを有効にしている場合、フィルタ前の全てのリンクを成果物として出力する", func(t *testing.T) {
+		conf := buildConfiguration()
+		conf.Options["built_in.crawler.link_graph"] = true
+		crawler, err := BuiltInCrawlerProvider(ctx, conf)
+		if err != nil {
+			panic(err)
+		}
+
+		out := buildMockPipeline()
+		url, _ := testSanitizer.FromString(ts.URL + "/article.html")
+
+		err = crawler.Crawl(ctx, &gokurou.PoppedURL{URL: url}, out)
+		if err != nil {
+			t.Errorf("Crawl() = %v", err)
+		}
+
+		if len(out.outLinks) != 1 || out.outLinks[0].From.String() != url.String() {
+			t.Errorf("Crawl() does NOT output link graph")
+			return
+		}
+
+		links := out.outLinks[0].Links
+		if len(links) != 1 || links[0].URL.String() != ts.URL+"/" || links[0].Text != "Top" {
+			t.Errorf("Crawl() output invalid link graph")
+		}
+
+		if len(out.collected) != 1 {
+			t.Errorf("Crawl() does NOT collect artifact")
+		}
+	})
+
+	t.Run("ホスト毎の統計情報を記録する場合、クロールの度に更新する", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "gokurou-host-stats")
+		if err != nil {
+			panic(err)
+		}
+		defer os.RemoveAll(dir)
+
+		conf := buildConfiguration()
+		conf.Options["built_in.crawler.host_stats_db_path"] = filepath.Join(dir, "hosts-%d.sqlite")
+		crawler, err := BuiltInCrawlerProvider(ctx, conf)
+		if err != nil {
+			panic(err)
+		}
+		defer crawler.Finish()
+
+		out := buildMockPipeline()
+		url, _ := testSanitizer.FromString(ts.URL + "/article.html")
+
+		for i := 0; i < 2; i++ {
+			if err := crawler.Crawl(ctx, &gokurou.PoppedURL{URL: url}, out); err != nil {
+				t.Errorf("Crawl() = %v", err)
+			}
+		}
+
+		stats, err := crawler.(*builtInCrawler).hostStats.find(url.Host())
+		if err != nil || stats == nil {
+			t.Errorf("Crawl() does NOT save host stats")
+			return
+		}
+
+		if stats.Pages != 2 || stats.Errors != 0 || stats.Server != "test-server" || stats.RobotsStatus != 200 ||
+			len(stats.IPs) != 1 || stats.IPs[0] != "127.0.0.1" {
+			t.Errorf("Crawl() saved invalid host stats: %+v", stats)
+		}
+	})
+
+	t.Run("スロットリングされた場合、バックオフしてロックを延長する", func(t *testing.T) {
+		conf := buildConfiguration()
+		conf.Options["built_in.crawler.backoff.base_sec"] = 30
+		conf.Options["built_in.crawler.backoff.max_sec"] = 3600
+		crawler, err := BuiltInCrawlerProvider(ctx, conf)
+		if err != nil {
+			panic(err)
+		}
+		defer crawler.Finish()
+
+		coordinator := &mockCoordinator{extended: make(map[string]time.Duration)}
+		ctx := gokurou.ContextWithCoordinator(ctx, coordinator)
+		throttled, _ := testSanitizer.FromString(ts.URL + "/throttled.html")
+		if err := crawler.Crawl(ctx, &gokurou.PoppedURL{URL: throttled}, buildMockPipeline()); err != nil {
+			t.Errorf("Crawl() = %v", err)
+		}
+
+		if ttl := coordinator.extended[throttled.Hostname()]; ttl != 120*time.Second {
+			t.Errorf("Crawl() extended lock for %s, want = %s", ttl, 120*time.Second)
+		}
+
+		// バックオフ中のホストはクロールせず、諦めた理由を記録する
+		out := buildMockPipeline()
+		url, _ := testSanitizer.FromString(ts.URL + "/index.html")
+		if err := crawler.Crawl(ctx, &gokurou.PoppedURL{URL: url}, out); err != nil {
+			t.Errorf("Crawl() = %v", err)
+		}
+
+		if len(out.pushed) != 0 || len(out.retried) != 0 {
+			t.Errorf("Crawl() crawled host in backoff")
+		}
+
+		if len(out.collected) != 1 || out.collected[0].StatusCode != 0 ||
+			out.collected[0].Error == nil || *out.collected[0].Error != (fetchFailure{Class: reasonBackoff, Phase: phaseRobots}) {
+			t.Errorf("Crawl() does NOT record skipped URL: %+v", out.collected)
+		}
+
+		// 再試行中のURLは、バックオフが終わった後に改めて再試行する
+		out = buildMockPipeline()
+		if err := crawler.Crawl(ctx, &gokurou.PoppedURL{URL: url, Attempt: 1}, out); err != nil {
+			t.Errorf("Crawl() = %v", err)
+		}
+
+		if len(out.collected) != 0 || len(out.retried) != 1 || out.retried[0].Delay <= 0 {
+			t.Errorf("Crawl() does NOT retry URL after backoff: collected = %+v, retried = %+v", out.collected, out.retried)
+		}
+	})
+
+	t.Run("IPアドレスでロックできないまま諦めた場合、取得せずに諦めたことを記録する", func(t *testing.T) {
+		crawler, err := BuiltInCrawlerProvider(ctx, buildConfiguration())
+		if err != nil {
+			panic(err)
+		}
+		defer crawler.Finish()
+
+		out := buildMockPipeline()
+		url, _ := testSanitizer.FromString(ts.URL + "/index.html")
+		if err := crawler.Crawl(ctx, &gokurou.PoppedURL{URL: url, Attempt: 1, Deferred: 100, LockFailed: true}, out); err != nil {
+			t.Errorf("Crawl() = %v", err)
+		}
+
+		if len(out.pushed) != 0 || len(out.retried) != 0 || len(out.collected) != 1 ||
+			out.collected[0].StatusCode != 0 || out.collected[0].Attempt != 1 ||
+			out.collected[0].Error == nil || *out.collected[0].Error != (fetchFailure{Class: reasonLocked, Phase: phaseRobots}) {
+			t.Errorf("Crawl() does NOT record URL given up locking: %+v", out.collected)
+		}
+	})
+
+	t.Run("再試行を有効にしている場合、一時的な失敗を再試行し、諦めた場合は失敗の理由を記録する", func(t *testing.T) {
+		conf := buildConfiguration()
+		conf.Options["built_in.crawler.retry.max_attempts"] = 2
+		conf.Options["built_in.crawler.retry.delay_sec"] = 60
+		crawler, err := BuiltInCrawlerProvider(ctx, conf)
+		if err != nil {
+			panic(err)
+		}
+		defer crawler.Finish()
+
+		closed := httptest.NewServer(http.NotFoundHandler())
+		closed.Close()
+
+		tests := []struct {
+			url        string
+			attempt    int
+			wantRetry  time.Duration // 再試行しない場合は0
+			wantReason string
+		}{
+			{url: closed.URL + "/", attempt: 0, wantRetry: 60 * time.Second},
+			{url: closed.URL + "/", attempt: 2, wantReason: "connect"},
+			{url: ts.URL + "/error.html", attempt: 1, wantRetry: 120 * time.Second},
+			{url: ts.URL + "/error.html", attempt: 2, wantReason: "http_5xx"},
+		}
+
+		for _, tt := range tests {
+			out := buildMockPipeline()
+			url, _ := testSanitizer.FromString(tt.url)
+			if err := crawler.Crawl(ctx, &gokurou.PoppedURL{URL: url, Attempt: tt.attempt}, out); err != nil {
+				t.Errorf("Crawl() = %v", err)
+			}
+
+			if tt.wantRetry > 0 {
+				if len(out.retried) != 1 || out.retried[0].Delay != tt.wantRetry || out.retried[0].Popped.Attempt != tt.attempt+1 {
+					t.Errorf("Crawl(%s) does NOT retry: %+v", url, out.retried)
+				}
+
+				if len(out.collected) != 0 {
+					t.Errorf("Crawl(%s) collected artifact for retried url", url)
+				}
+				continue
+			}
+
+			if len(out.retried) != 0 {
+				t.Errorf("Crawl(%s) retried over max attempts", url)
+			}
+
+			if len(out.collected) != 1 || out.collected[0].Error == nil || string(out.collected[0].Error.Class) != tt.wantReason || out.collected[0].Attempt != tt.attempt {
+				t.Errorf("Crawl(%s) does NOT collect failure reason", url)
+			}
+		}
+	})
+
+	t.Run("本文抽出を有効にしている場合、本文と単語数を収集する", func(t *testing.T) {
+		conf := buildConfiguration()
+		conf.Options["built_in.crawler.extract_text"] = true
+		crawler, err := BuiltInCrawlerProvider(ctx, conf)
+		if err != nil {
+			panic(err)
+		}
+
+		out := buildMockPipeline()
+		url, _ := testSanitizer.FromString(ts.URL + "/article.html")
+
+		err = crawler.Crawl(ctx, &gokurou.PoppedURL{URL: url}, out)
+		if err != nil {
+			t.Errorf("Crawl() = %v", err)
+		}
+
+		if len(out.collected) != 1 {
+			t.Errorf("Crawl() does NOT collect artifact")
+			return
+		}
+
+		art := out.collected[0]
+		if art.Text != "This is an article for testing main text extraction." || art.WordCount != 9 || art.Language != "en" {
+			t.Errorf("Crawl() collected invalid artifact(text = %q, word_count = %d, language = %s)", art.Text, art.WordCount, art.Language)
+		}
+
+		if len(out.pushed) != 1 || out.pushed[0].Language != "en" {
+			t.Errorf("Crawl() collected urls without language")
+		}
+	})
+
+	t.Run("<meta>で文字エンコーディングが宣言されている場合、それに従ってデコードする", func(t *testing.T) {
+		out := buildMockPipeline()
+		url, _ := testSanitizer.FromString(ts.URL + "/sjis.html")
+
+		err := crawler.Crawl(ctx, &gokurou.PoppedURL{URL: url}, out)
+		if err != nil {
+			t.Errorf("Crawl() = %v", err)
+		}
+
+		if len(out.collected) != 1 {
+			t.Errorf("Crawl() does NOT collect artifact")
+			return
+		}
+
+		art := out.collected[0]
+		if art.Title != "こんにちは、クローラー" || art.Charset != "shift_jis" || art.Language != "ja" {
+			t.Errorf("Crawl() collected invalid artifact(title = %s, charset = %s, language = %s)", art.Title, art.Charset, art.Language)
+		}
+	})
+
+	t.Run("重複排除を有効にしている場合、重複したページを成果物に記録しURLは収集しない", func(t *testing.T) {
+		conf := buildConfiguration()
+		conf.Options["built_in.crawler.dedup"] = true
+		conf.Options["built_in.crawler.dedup_drop_outlinks"] = true
+		crawler, err := BuiltInCrawlerProvider(ctx, conf)
+		if err != nil {
+			panic(err)
+		}
+
+		ctx := gokurou.ContextWithCoordinator(ctx, &mockCoordinator{hashes: make(map[string]string)})
+		out := buildMockPipeline()
+		url1, _ := testSanitizer.FromString(ts.URL + "/mirror1.html")
+		url2, _ := testSanitizer.FromString(ts.URL + "/mirror2.html")
+
+		for _, url := range []*www.SanitizedURL{url1, url2} {
+			if err := crawler.Crawl(ctx, &gokurou.PoppedURL{URL: url}, out); err != nil {
+				t.Errorf("Crawl() = %v", err)
+			}
+		}
+
+		if len(out.collected) != 2 {
+			t.Errorf("Crawl() does NOT collect artifact")
+			return
+		}
+
+		if len(out.collected[0].ContentHash) == 0 || len(out.collected[0].SimHash) != 16 || out.collected[0].DuplicateOf != "" {
+			t.Errorf("Crawl() collected invalid artifact for original page")
+		}
+
+		if out.collected[1].ContentHash != out.collected[0].ContentHash || out.collected[1].DuplicateOf != url1.String() {
+			t.Errorf("Crawl() does NOT mark duplicated page(duplicate_of = %s)", out.collected[1].DuplicateOf)
+		}
+
+		if len(out.pushed) != 1 || out.pushed[0].From.String() != url1.String() {
+			t.Errorf("Crawl() collects urls from duplicated page")
+		}
+	})
+
+	t.Run("重複の判定に失敗した場合、重複していないものとしてクロールを続ける", func(t *testing.T) {
+		conf := buildConfiguration()
+		conf.Options["built_in.crawler.dedup"] = true
+		crawler, err := BuiltInCrawlerProvider(ctx, conf)
+		if err != nil {
+			panic(err)
+		}
+		defer crawler.Finish()
+
+		ctx := gokurou.ContextWithCoordinator(ctx, &mockCoordinator{dedupErr: xerrors.New("connection refused")})
+		out := buildMockPipeline()
+		url, _ := testSanitizer.FromString(ts.URL + "/mirror1.html")
+		if err := crawler.Crawl(ctx, &gokurou.PoppedURL{URL: url}, out); err != nil {
+			t.Errorf("Crawl() = %v", err)
+		}
+
+		if len(out.collected) != 1 || out.collected[0].DuplicateOf != "" || len(out.pushed) != 1 {
+			t.Errorf("Crawl() does NOT continue after failure of finding duplicate content")
+		}
+	})
+
 	t.Run("noindexなページの場合、結果を収集しないがURLは収集する", func(t *testing.T) {
 		out := buildMockPipeline()
-		url, _ := www.SanitizedURLFromString(ts.URL + "/noindex.html")
+		url, _ := testSanitizer.FromString(ts.URL + "/noindex.html")
 
-		err := crawler.Crawl(ctx, url, out)
+		err := crawler.Crawl(ctx, &gokurou.PoppedURL{URL: url}, out)
 		if err != nil {
 			t.Errorf("Crawl() = %v", err)
 		}
@@ -145,25 +658,27 @@ func TestDefaultCrawler_Crawl(t *testing.T) {
 		}
 	})
 
-	t.Run("robots.txtでインデックスを禁止されているページの場合、結果を収集しない", func(t *testing.T) {
+	t.Run("robots.txtでインデックスを禁止されているページの場合、結果を収集せずに禁止されたことを記録する", func(t *testing.T) {
 		out := buildMockPipeline()
-		url, _ := www.SanitizedURLFromString(ts.URL + "/admin.html")
+		url, _ := testSanitizer.FromString(ts.URL + "/admin.html")
 
-		err := crawler.Crawl(ctx, url, out)
+		err := crawler.Crawl(ctx, &gokurou.PoppedURL{URL: url}, out)
 		if err != nil {
 			t.Errorf("Crawl() = %v", err)
 		}
 
-		if len(out.collected) != 0 || len(out.pushed) != 0 {
+		if len(out.pushed) != 0 {
 			t.Errorf("Crawl() collects data from disallowed page")
 		}
+
+		assertFailure(t, out, "disallowed", "robots")
 	})
 
 	t.Run("robots.txtで無限にリダイレクトする場合、中断してページを取得する", func(t *testing.T) {
 		out := buildMockPipeline()
-		url, _ := www.SanitizedURLFromString(ts2.URL + "/index.html")
+		url, _ := testSanitizer.FromString(ts2.URL + "/index.html")
 
-		err := crawler.Crawl(ctx, url, out)
+		err := crawler.Crawl(ctx, &gokurou.PoppedURL{URL: url}, out)
 		if err != nil {
 			t.Errorf("Crawl() = %v", err)
 		}
@@ -184,9 +699,9 @@ func TestDefaultCrawler_Crawl(t *testing.T) {
 
 	t.Run("ページ取得で無限にリダイレクトする場合、途中で諦める", func(t *testing.T) {
 		out := buildMockPipeline()
-		url, _ := www.SanitizedURLFromString(ts.URL + "/redirect")
+		url, _ := testSanitizer.FromString(ts.URL + "/redirect")
 
-		err := crawler.Crawl(ctx, url, out)
+		err := crawler.Crawl(ctx, &gokurou.PoppedURL{URL: url}, out)
 		if err != nil {
 			t.Errorf("Crawl() = %v", err)
 		}
@@ -199,19 +714,544 @@ func TestDefaultCrawler_Crawl(t *testing.T) {
 		if art.URL != url.String() || art.StatusCode != 301 || art.Server != "test-server" {
 			t.Errorf("Crawl() collected invalid artifact")
 		}
+
+		if len(art.Redirects) != 3 {
+			t.Errorf("Crawl() collected %d redirects, want = 3", len(art.Redirects))
+		}
 	})
 
-	t.Run("リダイレクト込みで時間を浪費するようなフローを辿った場合、途中で諦める", func(t *testing.T) {
+	t.Run("別のホストにリダイレクトする場合、リダイレクトの過程を記録し、リダイレクト先のURLを収集する", func(t *testing.T) {
 		out := buildMockPipeline()
-		url, _ := www.SanitizedURLFromString(ts.URL + "/slowloop")
+		url, _ := testSanitizer.FromString(ts.URL + "/moved")
 
-		err := crawler.Crawl(ctx, url, out)
+		err := crawler.Crawl(ctx, &gokurou.PoppedURL{URL: url, Depth: 1}, out)
 		if err != nil {
 			t.Errorf("Crawl() = %v", err)
 		}
 
-		if len(out.collected) != 0 || len(out.pushed) != 0 {
+		if len(out.collected) != 1 {
+			t.Errorf("Crawl() does NOT collect artifact")
+			return
+		}
+
+		want := []redirectHop{
+			{URL: ts.URL + "/moved", Status: 302, Location: "/moved-again"},
+			{URL: ts.URL + "/moved-again", Status: 301, Location: "http://www.example.com/moved"},
+		}
+
+		got := out.collected[0].Redirects
+		if len(got) != len(want) {
+			t.Errorf("Crawl() collected redirects = %+v, want = %+v", got, want)
+		} else {
+			for i := range want {
+				if *got[i] != want[i] {
+					t.Errorf("Crawl() collected redirects[%d] = %+v, want = %+v", i, got[i], want[i])
+				}
+			}
+		}
+
+		if len(out.pushed) != 1 || out.pushed[0].Depth != 1 || len(out.pushed[0].Spawned) != 1 ||
+			out.pushed[0].Spawned[0].String() != "http://www.example.com/moved" {
+			t.Errorf("Crawl() does NOT collect redirect target")
+		}
+	})
+
+	t.Run("リダイレクト込みで時間を浪費するようなフローを辿った場合、途中で諦めて失敗を記録する", func(t *testing.T) {
+		out := buildMockPipeline()
+		url, _ := testSanitizer.FromString(ts.URL + "/slowloop")
+
+		err := crawler.Crawl(ctx, &gokurou.PoppedURL{URL: url}, out)
+		if err != nil {
+			t.Errorf("Crawl() = %v", err)
+		}
+
+		if len(out.pushed) != 0 {
 			t.Errorf("Crawl() collects data")
 		}
+
+		assertFailure(t, out, "timeout", "response")
+		if out.collected[0].Elapsed < 1 {
+			t.Errorf("Crawl() does NOT record elapsed time of failed request")
+		}
+	})
+
+	t.Run("Brotliで圧縮されたページを展開して解析し、プロトコルを記録する", func(t *testing.T) {
+		out := buildMockPipeline()
+		url, _ := testSanitizer.FromString(ts.URL + "/brotli.html")
+		if err := crawler.Crawl(ctx, &gokurou.PoppedURL{URL: url}, out); err != nil {
+			t.Errorf("Crawl() = %v", err)
+		}
+
+		if len(out.collected) != 1 || out.collected[0].Title != "br, gzip" || out.collected[0].Protocol != "HTTP/1.1" {
+			t.Errorf("Crawl() does NOT decode compressed page: %+v", out.collected)
+		}
+	})
+
+	t.Run("HTTP/2を有効にしている場合、HTTP/2で取得する", func(t *testing.T) {
+		tlsServer := httptest.NewUnstartedServer(ts.Config.Handler)
+		tlsServer.EnableHTTP2 = true
+		tlsServer.StartTLS()
+		defer tlsServer.Close()
+
+		settings := DefaultHTTPSettings()
+		settings.EnableHTTP2 = true
+
+		conf := buildConfiguration()
+		conf.Options["built_in.crawler.http"] = settings
+		crawler, err := BuiltInCrawlerProvider(ctx, conf)
+		if err != nil {
+			panic(err)
+		}
+		defer crawler.Finish()
+
+		// テストサーバーの証明書を信頼させる
+		transport := crawler.(*builtInCrawler).httpClients.base.transport
+		transport.TLSClientConfig.RootCAs = tlsServer.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+
+		out := buildMockPipeline()
+		url, _ := testSanitizer.FromString(tlsServer.URL + "/index.html")
+		if err := crawler.Crawl(ctx, &gokurou.PoppedURL{URL: url}, out); err != nil {
+			t.Errorf("Crawl() = %v", err)
+		}
+
+		if len(out.collected) != 1 || out.collected[0].Protocol != "HTTP/2.0" {
+			t.Errorf("Crawl() does NOT fetch page by HTTP/2: %+v", out.collected)
+		}
+	})
+
+	t.Run("HTTPSで取得した場合、TLSの情報を記録する", func(t *testing.T) {
+		tlsServer := httptest.NewTLSServer(ts.Config.Handler)
+		defer tlsServer.Close()
+
+		tests := []struct {
+			name               string
+			trusted            bool
+			acceptInvalidCerts bool
+			wantVerified       bool
+			wantFailure        bool
+		}{
+			{name: "信頼できる証明書の場合", trusted: true, wantVerified: true},
+			{name: "無効な証明書でも取得する場合", acceptInvalidCerts: true, wantVerified: false},
+			{name: "無効な証明書の場合", wantFailure: true},
+		}
+
+		for _, tt := range tests {
+			settings := DefaultHTTPSettings()
+			settings.AcceptInvalidCerts = tt.acceptInvalidCerts
+
+			conf := buildConfiguration()
+			conf.Options["built_in.crawler.http"] = settings
+			crawler, err := BuiltInCrawlerProvider(ctx, conf)
+			if err != nil {
+				panic(err)
+			}
+
+			if tt.trusted {
+				transport := crawler.(*builtInCrawler).httpClients.base.transport
+				transport.TLSClientConfig.RootCAs = tlsServer.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+			}
+
+			out := buildMockPipeline()
+			url, _ := testSanitizer.FromString(tlsServer.URL + "/index.html")
+			if err := crawler.Crawl(ctx, &gokurou.PoppedURL{URL: url}, out); err != nil {
+				t.Errorf("%s: Crawl() = %v", tt.name, err)
+			}
+			_ = crawler.Finish()
+
+			if tt.wantFailure {
+				assertFailure(t, out, "tls", "robots")
+				continue
+			}
+
+			if len(out.collected) != 1 || out.collected[0].TLS == nil {
+				t.Errorf("%s: Crawl() does NOT record TLS info", tt.name)
+				continue
+			}
+
+			info := out.collected[0].TLS
+			if len(info.Version) == 0 || len(info.CipherSuite) == 0 || len(info.Chain) == 0 || len(info.Chain[0].Subject) == 0 {
+				t.Errorf("%s: Crawl() records incomplete TLS info: %+v", tt.name, info)
+			}
+
+			if verified := len(info.VerificationError) == 0; verified != tt.wantVerified {
+				t.Errorf("%s: Crawl() records verification error = %s", tt.name, info.VerificationError)
+			}
+		}
+	})
+
+	t.Run("プロキシを設定している場合、正常なプロキシを経由して取得し、用いたプロキシを記録する", func(t *testing.T) {
+		var proxied int32
+		proxyServer := buildProxyServer(&proxied)
+		defer proxyServer.Close()
+
+		dead := httptest.NewServer(http.NotFoundHandler())
+		dead.Close()
+
+		conf := buildConfiguration()
+		conf.Options["built_in.crawler.proxy.urls"] = []string{dead.URL, proxyServer.URL}
+		conf.Options["built_in.crawler.proxy.rotation"] = "round_robin"
+		crawler, err := BuiltInCrawlerProvider(ctx, conf)
+		if err != nil {
+			panic(err)
+		}
+		defer crawler.Finish()
+
+		for i := 0; i < 2; i++ {
+			out := buildMockPipeline()
+			url, _ := testSanitizer.FromString(ts.URL + "/index.html")
+			if err := crawler.Crawl(ctx, &gokurou.PoppedURL{URL: url}, out); err != nil {
+				t.Errorf("Crawl() = %v", err)
+			}
+
+			if len(out.collected) != 1 || out.collected[0].Title != "Hello, crawler" || out.collected[0].Proxy != proxyServer.URL {
+				t.Errorf("Crawl() does NOT fetch page via healthy proxy: %+v", out.collected)
+			}
+		}
+
+		if atomic.LoadInt32(&proxied) != 4 { // robots.txtとページを2回ずつ
+			t.Errorf("proxy received %d requests, want = 4", proxied)
+		}
+	})
+
+	t.Run("稼働中にプロキシが停止した場合、そのプロキシを以降は用いずに再試行する", func(t *testing.T) {
+		var proxied int32
+		dying := buildProxyServer(&proxied)
+		alive := buildProxyServer(&proxied)
+		defer alive.Close()
+
+		conf := buildConfiguration()
+		conf.Options["built_in.crawler.proxy.urls"] = []string{dying.URL, alive.URL}
+		conf.Options["built_in.crawler.proxy.rotation"] = "round_robin"
+		conf.Options["built_in.crawler.retry.max_attempts"] = 1
+		conf.Options["built_in.crawler.retry.delay_sec"] = 60
+		crawler, err := BuiltInCrawlerProvider(ctx, conf)
+		if err != nil {
+			panic(err)
+		}
+		defer crawler.Finish()
+
+		// 起動時のヘルスチェックの後に停止する
+		dying.Close()
+
+		url, _ := testSanitizer.FromString(ts.URL + "/index.html")
+		out := buildMockPipeline()
+		if err := crawler.Crawl(ctx, &gokurou.PoppedURL{URL: url}, out); err != nil {
+			t.Errorf("Crawl() = %v", err)
+		}
+
+		if len(out.retried) != 1 || len(out.collected) != 0 {
+			t.Fatalf("Crawl() does NOT retry url failed by dead proxy")
+		}
+
+		retried := out.retried[0].Popped
+		out = buildMockPipeline()
+		if err := crawler.Crawl(ctx, retried, out); err != nil {
+			t.Errorf("Crawl() = %v", err)
+		}
+
+		if len(out.collected) != 1 || out.collected[0].Title != "Hello, crawler" || out.collected[0].Proxy != alive.URL {
+			t.Errorf("Crawl() uses dead proxy: %+v", out.collected)
+		}
+	})
+
+	t.Run("プロキシのアドレスは、アクセスを許可するネットワークに含まれていなくても接続する", func(t *testing.T) {
+		var proxied int32
+		proxyServer := buildProxyServer(&proxied) // 127.0.0.1で起動する
+		defer proxyServer.Close()
+
+		listener, err := net.Listen("tcp", "127.0.0.2:0")
+		if err != nil {
+			t.Skipf("can't listen on 127.0.0.2: %v", err)
+		}
+
+		target := httptest.NewUnstartedServer(ts.Config.Handler)
+		target.Listener = listener
+		target.Start()
+		defer target.Close()
+
+		conf := buildConfiguration()
+		conf.Options["built_in.crawler.allowed_networks"] = []string{"127.0.0.2/32"}
+		conf.Options["built_in.crawler.proxy.urls"] = []string{proxyServer.URL}
+		crawler, err := BuiltInCrawlerProvider(ctx, conf)
+		if err != nil {
+			panic(err)
+		}
+		defer crawler.Finish()
+
+		out := buildMockPipeline()
+		url, _ := testSanitizer.FromString(target.URL + "/index.html")
+		if err := crawler.Crawl(ctx, &gokurou.PoppedURL{URL: url}, out); err != nil {
+			t.Errorf("Crawl() = %v", err)
+		}
+
+		if len(out.collected) != 1 || out.collected[0].Title != "Hello, crawler" || out.collected[0].Proxy != proxyServer.URL {
+			t.Errorf("Crawl() does NOT connect to proxy on private address: %+v", out.collected)
+		}
+	})
+
+	t.Run("プロキシを経由する場合も、アクセスを許可しないアドレスへは取得しない", func(t *testing.T) {
+		var proxied int32
+		proxyServer := buildProxyServer(&proxied)
+		defer proxyServer.Close()
+
+		conf := buildConfiguration()
+		conf.Options["built_in.crawler.allowed_networks"] = []string{}
+		conf.Options["built_in.crawler.proxy.urls"] = []string{proxyServer.URL}
+		crawler, err := BuiltInCrawlerProvider(ctx, conf)
+		if err != nil {
+			panic(err)
+		}
+		defer crawler.Finish()
+
+		out := buildMockPipeline()
+		url, _ := testSanitizer.FromString(ts.URL + "/index.html")
+		if err := crawler.Crawl(ctx, &gokurou.PoppedURL{URL: url}, out); err != nil {
+			t.Errorf("Crawl() = %v", err)
+		}
+
+		assertFailure(t, out, "blocked", "robots")
+		if atomic.LoadInt32(&proxied) != 0 {
+			t.Errorf("proxy received request to blocked address")
+		}
 	})
+
+	t.Run("ヘッダーを設定している場合、全てのリクエストで送信する", func(t *testing.T) {
+		conf := buildConfiguration()
+		conf.Options["built_in.crawler.headers"] = map[string]string{
+			"Accept-Language": "ja",
+			"From":            "crawler@example.com",
+			"User-Agent":      "overridden",
+		}
+		crawler, err := BuiltInCrawlerProvider(ctx, conf)
+		if err != nil {
+			panic(err)
+		}
+		defer crawler.Finish()
+
+		out := buildMockPipeline()
+		url, _ := testSanitizer.FromString(ts.URL + "/headers.html")
+		if err := crawler.Crawl(ctx, &gokurou.PoppedURL{URL: url}, out); err != nil {
+			t.Errorf("Crawl() = %v", err)
+		}
+
+		if len(out.collected) != 1 || out.collected[0].Title != "ja|crawler@example.com|test" {
+			t.Errorf("Crawl() does NOT send configured headers: %+v", out.collected)
+		}
+	})
+
+	t.Run("Cookieを保持する場合、ホスト毎に保存し以降のリクエストで送信する", func(t *testing.T) {
+		conf := buildConfiguration()
+		conf.Options["built_in.crawler.cookie_jar_db_path"] = filepath.Join(t.TempDir(), "cookies-%d.sqlite")
+
+		titles := make([]string, 0, 2)
+		for i := 0; i < 2; i++ {
+			// Crawlerを生成し直しても保存したCookieを用いる
+			crawler, err := BuiltInCrawlerProvider(ctx, conf)
+			if err != nil {
+				panic(err)
+			}
+
+			out := buildMockPipeline()
+			url, _ := testSanitizer.FromString(ts.URL + "/consent.html")
+			if err := crawler.Crawl(ctx, &gokurou.PoppedURL{URL: url}, out); err != nil {
+				t.Errorf("Crawl() = %v", err)
+			}
+			_ = crawler.Finish()
+
+			if len(out.collected) == 1 {
+				titles = append(titles, out.collected[0].Title)
+			}
+		}
+
+		if len(titles) != 2 || titles[0] != "Consent required" || titles[1] != "Welcome" {
+			t.Errorf("Crawl() does NOT keep cookies: %v", titles)
+		}
+	})
+
+	t.Run("ボディが最大サイズを超える場合、途中まで解析し打ち切ったことを記録する", func(t *testing.T) {
+		settings := DefaultHTTPSettings()
+		settings.MaxBodySize = 1024
+
+		conf := buildConfiguration()
+		conf.Options["built_in.crawler.http"] = settings
+		crawler, err := BuiltInCrawlerProvider(ctx, conf)
+		if err != nil {
+			panic(err)
+		}
+		defer crawler.Finish()
+
+		out := buildMockPipeline()
+		url, _ := testSanitizer.FromString(ts.URL + "/large.html")
+		if err := crawler.Crawl(ctx, &gokurou.PoppedURL{URL: url}, out); err != nil {
+			t.Errorf("Crawl() = %v", err)
+		}
+
+		if len(out.collected) != 1 || out.collected[0].Title != "Large page" || !out.collected[0].Truncated {
+			t.Errorf("Crawl() does NOT record truncated page")
+		}
+
+		if len(out.pushed) != 1 || len(out.pushed[0].Spawned) != 1 || out.pushed[0].Spawned[0].String() != "http://www.example.com/head.html" {
+			t.Errorf("Crawl() parses body over max size")
+		}
+	})
+
+	t.Run("ドメイン毎にHTTPクライアントの設定を上書きしている場合、その設定で取得する", func(t *testing.T) {
+		impatient := DefaultHTTPSettings()
+		impatient.Timeout = 100 * time.Millisecond
+
+		conf := buildConfiguration()
+		conf.Options["built_in.crawler.http_overrides"] = map[string]*HTTPSettings{"127.0.0.1": impatient}
+		crawler, err := BuiltInCrawlerProvider(ctx, conf)
+		if err != nil {
+			panic(err)
+		}
+		defer crawler.Finish()
+
+		out := buildMockPipeline()
+		url, _ := testSanitizer.FromString(ts.URL + "/index.html")
+		if err := crawler.Crawl(ctx, &gokurou.PoppedURL{URL: url}, out); err != nil {
+			t.Errorf("Crawl() = %v", err)
+		}
+
+		assertFailure(t, out, "timeout", "response")
+	})
+}
+
+// クロールの失敗を表す成果物だけが収集されていることを検証する
+// 受け取ったリクエストを転送するだけのHTTPプロキシを起動する
+func buildProxyServer(proxied *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !r.URL.IsAbs() {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		atomic.AddInt32(proxied, 1)
+		req, _ := http.NewRequest(r.Method, r.URL.String(), nil)
+		req.Header = r.Header.Clone()
+		req.Header.Del("Proxy-Connection")
+
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+
+		for k, v := range resp.Header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(w, resp.Body)
+	}))
+}
+
+func assertFailure(t *testing.T, out *mockPipeline, class string, phase string) {
+	t.Helper()
+
+	if len(out.collected) != 1 {
+		t.Errorf("Crawl() collected %d artifacts, want = 1", len(out.collected))
+		return
+	}
+
+	failure := out.collected[0].Error
+	if failure == nil || string(failure.Class) != class || string(failure.Phase) != phase {
+		t.Errorf("Crawl() collected failure %+v, want = (%s, %s)", failure, class, phase)
+	}
+}
+
+// go test -raceで実行することで、並行してクロールした際に共有する状態を変更していないことを検証する
+func TestBuiltInCrawler_Crawl_Concurrently(t *testing.T) {
+	conf := buildConfiguration()
+	ctx, _ := gokurou.WorkerContext(gokurou.MustRootContext(conf), 1)
+	crawler, err := BuiltInCrawlerProvider(ctx, conf)
+	if err != nil {
+		panic(err)
+	}
+	defer crawler.Finish()
+
+	ts := buildTestServer()
+	defer ts.Close()
+
+	ts2 := buildTestServer2()
+	defer ts2.Close()
+
+	// robots.txtとページの取得でそれぞれリダイレクトするURLを混ぜてクロールする
+	urls := []string{ts.URL + "/moved", ts.URL + "/redirect", ts2.URL + "/index.html", ts.URL + "/index.html"}
+	outs := make([]*mockPipeline, len(urls)*5)
+
+	var wg sync.WaitGroup
+	for i := range outs {
+		outs[i] = buildMockPipeline()
+		url, _ := testSanitizer.FromString(urls[i%len(urls)])
+
+		wg.Add(1)
+		go func(out *mockPipeline) {
+			defer wg.Done()
+			if err := crawler.Crawl(ctx, &gokurou.PoppedURL{URL: url}, out); err != nil {
+				t.Errorf("Crawl() = %v", err)
+			}
+		}(outs[i])
+	}
+
+	wg.Wait()
+
+	for i, out := range outs {
+		if len(out.collected) != 1 || out.collected[0].Error != nil {
+			t.Errorf("Crawl(%s) does NOT collect artifact", urls[i%len(urls)])
+		}
+	}
+}
+
+func TestDetermineEncoding(t *testing.T) {
+	tests := []struct {
+		head        string
+		contentType string
+		want        string
+	}{
+		{head: "\xef\xbb\xbf<meta charset='shift_jis'>", contentType: "text/html; charset=euc-jp", want: "utf-8"},
+		{head: "<meta charset='shift_jis'>", contentType: "text/html; charset=euc-jp", want: "euc-jp"},
+		{head: "<meta charset='shift_jis'>", contentType: "text/html", want: "shift_jis"},
+		{head: "<meta http-equiv='content-type' content='text/html; charset=EUC-JP'>", contentType: "", want: "euc-jp"},
+		{head: "<title>\xe3\x81\x82</title>", contentType: "text/html", want: "utf-8"},
+		{head: "<title>\x82\xa0</title>", contentType: "text/html", want: ""},
+		{head: "<meta charset='windows-1252'><title>\xe9</title>", contentType: "text/html", want: ""},
+		{head: "<title>\xe9</title>", contentType: "text/html; charset=windows-1252", want: "windows-1252"},
+	}
+
+	for _, tt := range tests {
+		_, got := determineEncoding([]byte(tt.head), tt.contentType)
+		if got != tt.want {
+			t.Errorf("determineEncoding(%q, %s) = %s, want = %s", tt.head, tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func TestBuiltInCrawler_refererFor(t *testing.T) {
+	tests := []struct {
+		sendReferer bool
+		referrer    string
+		url         string
+		want        string
+	}{
+		{sendReferer: true, referrer: "http://example.com/", url: "http://example.com/a", want: "http://example.com/"},
+		{sendReferer: true, referrer: "https://example.com/", url: "https://example.com/a", want: "https://example.com/"},
+		{sendReferer: true, referrer: "https://example.com/", url: "http://example.com/a", want: ""},
+		{sendReferer: true, referrer: "", url: "http://example.com/a", want: ""},
+		{sendReferer: false, referrer: "http://example.com/", url: "http://example.com/a", want: ""},
+	}
+
+	for _, tt := range tests {
+		crawler := &builtInCrawler{sendReferer: tt.sendReferer}
+		popped := &gokurou.PoppedURL{}
+		popped.URL, _ = testSanitizer.FromString(tt.url)
+		if len(tt.referrer) > 0 {
+			popped.Referrer, _ = testSanitizer.FromString(tt.referrer)
+		}
+
+		got := crawler.refererFor(popped)
+		if (got == nil && tt.want != "") || (got != nil && got.String() != tt.want) {
+			t.Errorf("refererFor(%s -> %s) = %v, want = %s", tt.referrer, tt.url, got, tt.want)
+		}
+	}
 }
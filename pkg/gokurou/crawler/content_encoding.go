@@ -0,0 +1,80 @@
+package crawler
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"golang.org/x/xerrors"
+)
+
+// リクエスト時に送信するAccept-Encoding
+// 独自に送信するとTransportは自動で展開しないため、展開はdecodingBodyで行う
+const acceptEncoding = "br, gzip"
+
+// Content-Encodingに従ってボディを展開するReadCloser
+// 展開の開始時にヘッダーを読む形式もあるため、最初に読み込まれるまで展開を始めない
+type decodingBody struct {
+	body     io.ReadCloser
+	encoding string
+	decoder  io.Reader
+	close    func() // 展開に用いたリソースの解放。不要ならnil
+	err      error
+}
+
+// レスポンスのボディを、Content-Encodingに従って展開するものに差し替える
+// 展開後は元の長さ等は意味を持たないため、関連するヘッダーを削除する
+func decodeContent(resp *http.Response) {
+	enc := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if len(enc) == 0 || enc == "identity" {
+		return
+	}
+
+	resp.Body = &decodingBody{body: resp.Body, encoding: enc}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+}
+
+func (db *decodingBody) Read(p []byte) (int, error) {
+	if db.decoder == nil && db.err == nil {
+		db.decoder, db.err = db.newDecoder()
+	}
+
+	if db.err != nil {
+		return 0, db.err
+	}
+	return db.decoder.Read(p)
+}
+
+func (db *decodingBody) newDecoder() (io.Reader, error) {
+	switch db.encoding {
+	case "br":
+		return brotli.NewReader(db.body), nil
+
+	case "gzip", "x-gzip":
+		return gzip.NewReader(db.body)
+
+	case "zstd":
+		decoder, err := zstd.NewReader(db.body, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		db.close = decoder.Close
+		return decoder, nil
+
+	default:
+		return nil, xerrors.Errorf("unsupported content encoding: %s", db.encoding)
+	}
+}
+
+func (db *decodingBody) Close() error {
+	if db.close != nil {
+		db.close()
+	}
+	return db.body.Close()
+}
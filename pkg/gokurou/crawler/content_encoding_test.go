@@ -0,0 +1,80 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+func compress(encoding string, content string) []byte {
+	buf := &bytes.Buffer{}
+
+	var w io.WriteCloser
+	switch encoding {
+	case "br":
+		w = brotli.NewWriter(buf)
+	case "gzip":
+		w = gzip.NewWriter(buf)
+	case "zstd":
+		w, _ = zstd.NewWriter(buf)
+	default:
+		buf.WriteString(content)
+		return buf.Bytes()
+	}
+
+	_, _ = w.Write([]byte(content))
+	_ = w.Close()
+	return buf.Bytes()
+}
+
+func TestDecodeContent(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoding string
+		wantErr  bool
+	}{
+		{name: "Brotliで圧縮されている場合、展開する", encoding: "br"},
+		{name: "gzipで圧縮されている場合、展開する", encoding: "gzip"},
+		{name: "zstdで圧縮されている場合、展開する", encoding: "zstd"},
+		{name: "圧縮されていない場合、そのまま読み込む", encoding: ""},
+		{name: "対応していない形式の場合、エラーを返す", encoding: "compress", wantErr: true},
+	}
+
+	content := "<title>Hello, crawler</title>"
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{
+				Header: http.Header{},
+				Body:   ioutil.NopCloser(bytes.NewReader(compress(tt.encoding, content))),
+			}
+			if len(tt.encoding) > 0 {
+				resp.Header.Set("Content-Encoding", tt.encoding)
+			}
+
+			decodeContent(resp)
+			got, err := ioutil.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("decodeContent() does NOT return error for %s", tt.encoding)
+				}
+				return
+			}
+
+			if err != nil || string(got) != content {
+				t.Errorf("decodeContent() = (%s, %v), want = %s", got, err, content)
+			}
+
+			if len(resp.Header.Get("Content-Encoding")) > 0 {
+				t.Errorf("decodeContent() does NOT remove Content-Encoding")
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package crawler
+
+import (
+	"database/sql"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/murakmii/gokurou/pkg/gokurou"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// ホスト毎に保持するCookieの最大数(RFC 6265 6.1で推奨される下限)
+// 超えた場合は最も前に設定されたものから捨てる
+const maxCookiesPerHost = 50
+
+// ホスト毎にCookieを保持し、SQLiteに保存するCookieJar
+// 同意画面等で初回にCookieを設定するサイトを、複数のページに渡ってクロールするために用いる
+// Domain属性は無視し、Cookieを設定したホストにのみ送信する
+// 保存先は通常URLFrontierのローカルDBと同じファイルとし、cookiesテーブルのみを用いる
+type cookieJar struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+func openCookieJar(path string) (*cookieJar, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to open cookie jar db: %v", err)
+	}
+
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+
+	query := `CREATE TABLE IF NOT EXISTS cookies(
+		host TEXT NOT NULL,
+		name TEXT NOT NULL,
+		path TEXT NOT NULL,
+		value TEXT NOT NULL,
+		secure INTEGER NOT NULL,
+		expires_at INTEGER NOT NULL,
+		PRIMARY KEY(host, name, path)
+	)`
+
+	if _, err := db.Exec(query); err != nil {
+		_ = db.Close()
+		return nil, xerrors.Errorf("failed to setup cookie jar db: %v", err)
+	}
+
+	return &cookieJar{db: db, now: time.Now}, nil
+}
+
+// http.CookieJarの実装
+// CookieJarはエラーを返せないため、保存に失敗したCookieは捨てる
+func (jar *cookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	host := strings.ToLower(u.Hostname())
+	now := jar.now()
+
+	for _, cookie := range cookies {
+		path := cookie.Path
+		if len(path) == 0 || path[0] != '/' {
+			path = defaultCookiePath(u.Path)
+		}
+
+		// 有効期限がないセッションCookieも、クロールの間は保持し続ける
+		var expiresAt int64
+		switch {
+		case cookie.MaxAge < 0:
+			expiresAt = -1
+		case cookie.MaxAge > 0:
+			expiresAt = now.Add(time.Duration(cookie.MaxAge) * time.Second).Unix()
+		case !cookie.Expires.IsZero():
+			expiresAt = cookie.Expires.Unix()
+		}
+
+		if expiresAt != 0 && expiresAt <= now.Unix() {
+			_, _ = jar.db.Exec("DELETE FROM cookies WHERE host = ? AND name = ? AND path = ?", host, cookie.Name, path)
+			continue
+		}
+
+		_, _ = jar.db.Exec(
+			"INSERT OR REPLACE INTO cookies VALUES(?, ?, ?, ?, ?, ?)",
+			host, cookie.Name, path, cookie.Value, cookie.Secure, expiresAt,
+		)
+	}
+
+	jar.evict(host, now)
+}
+
+// 有効期限が切れたCookieと、最大数を超えたCookieを捨てる
+// INSERT OR REPLACEは置き換えた行にも新しいrowidを割り当てるため、rowidが小さいものほど前に設定されたものとなる
+func (jar *cookieJar) evict(host string, now time.Time) {
+	_, _ = jar.db.Exec("DELETE FROM cookies WHERE host = ? AND expires_at <> 0 AND expires_at <= ?", host, now.Unix())
+	_, _ = jar.db.Exec(
+		"DELETE FROM cookies WHERE host = ? AND rowid NOT IN (SELECT rowid FROM cookies WHERE host = ? ORDER BY rowid DESC LIMIT ?)",
+		host, host, maxCookiesPerHost,
+	)
+}
+
+// http.CookieJarの実装
+func (jar *cookieJar) Cookies(u *url.URL) []*http.Cookie {
+	rows, err := jar.db.Query(
+		"SELECT name, path, value, secure FROM cookies WHERE host = ? AND (expires_at = 0 OR expires_at > ?) ORDER BY LENGTH(path) DESC",
+		strings.ToLower(u.Hostname()),
+		jar.now().Unix(),
+	)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	path := u.Path
+	if len(path) == 0 {
+		path = "/"
+	}
+
+	cookies := make([]*http.Cookie, 0)
+	for rows.Next() {
+		var name, cookiePath, value string
+		var secure bool
+		if err := rows.Scan(&name, &cookiePath, &value, &secure); err != nil {
+			return nil
+		}
+
+		if secure && u.Scheme != "https" {
+			continue
+		}
+
+		if matchCookiePath(path, cookiePath) {
+			cookies = append(cookies, &http.Cookie{Name: name, Value: value})
+		}
+	}
+
+	return cookies
+}
+
+func (jar *cookieJar) close() error {
+	return jar.db.Close()
+}
+
+// 設定されたパスに保存された、全てのworkerのCookieを削除する
+// URLFrontierのローカルDBと同じファイルに保存している場合、そちらの初期化で既に削除されていることがある
+func ResetCookieJar(conf *gokurou.Configuration) error {
+	path := conf.OptionAsString(cookieJarConfKey)
+	if path == nil || len(*path) == 0 {
+		return nil
+	}
+
+	paths, err := filepath.Glob(strings.Replace(*path, "%d", "*", -1))
+	if err != nil {
+		return xerrors.Errorf("invalid '%s' config: %v", cookieJarConfKey, err)
+	}
+
+	for _, path := range paths {
+		jar, err := openCookieJar(path)
+		if err != nil {
+			return err
+		}
+
+		_, err = jar.db.Exec("DELETE FROM cookies")
+		_ = jar.close()
+		if err != nil {
+			return xerrors.Errorf("failed to reset cookie jar: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// Path属性がない場合のパス(RFC 6265 5.1.4)
+func defaultCookiePath(path string) string {
+	if len(path) == 0 || path[0] != '/' {
+		return "/"
+	}
+
+	i := strings.LastIndex(path, "/")
+	if i == 0 {
+		return "/"
+	}
+	return path[:i]
+}
+
+// リクエストのパスがCookieのパスに一致するならtrueを返す(RFC 6265 5.1.4)
+func matchCookiePath(path string, cookiePath string) bool {
+	if !strings.HasPrefix(path, cookiePath) {
+		return false
+	}
+
+	return len(path) == len(cookiePath) || strings.HasSuffix(cookiePath, "/") || path[len(cookiePath)] == '/'
+}
@@ -0,0 +1,155 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/murakmii/gokurou/pkg/gokurou"
+)
+
+func TestCookieJar_Cookies(t *testing.T) {
+	now := time.Date(2019, 9, 1, 0, 0, 0, 0, time.UTC)
+	set, _ := url.Parse("http://www.example.com/docs/index.html")
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+		url    string
+		want   bool
+	}{
+		{name: "同じホストの場合、送信する", cookie: &http.Cookie{Name: "a", Value: "1", Path: "/"}, url: "http://www.example.com/", want: true},
+		{name: "別のホストの場合、送信しない", cookie: &http.Cookie{Name: "a", Value: "1", Path: "/", Domain: "example.com"}, url: "http://example.com/", want: false},
+		{name: "Path属性に一致する場合、送信する", cookie: &http.Cookie{Name: "a", Value: "1", Path: "/docs"}, url: "http://www.example.com/docs/page.html", want: true},
+		{name: "Path属性に前方一致するだけの場合、送信しない", cookie: &http.Cookie{Name: "a", Value: "1", Path: "/docs"}, url: "http://www.example.com/docsearch", want: false},
+		{name: "Path属性がない場合、設定したページのディレクトリ以下に送信する", cookie: &http.Cookie{Name: "a", Value: "1"}, url: "http://www.example.com/", want: false},
+		{name: "Secure属性がある場合、HTTPSでのみ送信する", cookie: &http.Cookie{Name: "a", Value: "1", Path: "/", Secure: true}, url: "http://www.example.com/", want: false},
+		{name: "有効期限が切れている場合、送信しない", cookie: &http.Cookie{Name: "a", Value: "1", Path: "/", Expires: now.Add(-time.Hour)}, url: "http://www.example.com/", want: false},
+		{name: "有効期限内の場合、送信する", cookie: &http.Cookie{Name: "a", Value: "1", Path: "/", MaxAge: 60}, url: "http://www.example.com/", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jar, err := openCookieJar(":memory:")
+			if err != nil {
+				t.Fatalf("openCookieJar() = %v", err)
+			}
+			defer jar.close()
+			jar.now = func() time.Time { return now }
+
+			jar.SetCookies(set, []*http.Cookie{tt.cookie})
+
+			u, _ := url.Parse(tt.url)
+			got := jar.Cookies(u)
+			if sent := len(got) == 1 && got[0].Name == "a" && got[0].Value == "1"; sent != tt.want {
+				t.Errorf("Cookies(%s) = %v, want sent = %v", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCookieJar_SetCookies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.sqlite")
+	u, _ := url.Parse("http://www.example.com/")
+
+	jar, err := openCookieJar(path)
+	if err != nil {
+		t.Fatalf("openCookieJar() = %v", err)
+	}
+	jar.SetCookies(u, []*http.Cookie{{Name: "consent", Value: "yes"}, {Name: "session", Value: "abc"}})
+	jar.SetCookies(u, []*http.Cookie{{Name: "session", Value: "", MaxAge: -1}})
+	_ = jar.close()
+
+	// 保存したCookieは開き直しても保持している
+	jar, err = openCookieJar(path)
+	if err != nil {
+		t.Fatalf("openCookieJar() = %v", err)
+	}
+	defer jar.close()
+
+	got := jar.Cookies(u)
+	if len(got) != 1 || got[0].Name != "consent" || got[0].Value != "yes" {
+		t.Errorf("Cookies() = %v", got)
+	}
+}
+
+func TestCookieJar_SetCookies_MaxCookiesPerHost(t *testing.T) {
+	jar, err := openCookieJar(":memory:")
+	if err != nil {
+		t.Fatalf("openCookieJar() = %v", err)
+	}
+	defer jar.close()
+
+	u, _ := url.Parse("http://www.example.com/")
+	for i := 0; i < maxCookiesPerHost+10; i++ {
+		jar.SetCookies(u, []*http.Cookie{{Name: fmt.Sprintf("c%d", i), Value: "1", Path: "/"}})
+	}
+
+	// 別のホストのCookieは数に含めない
+	other, _ := url.Parse("http://example.org/")
+	jar.SetCookies(other, []*http.Cookie{{Name: "c0", Value: "1", Path: "/"}})
+
+	got := jar.Cookies(u)
+	if len(got) != maxCookiesPerHost {
+		t.Fatalf("Cookies() returns %d cookies, want = %d", len(got), maxCookiesPerHost)
+	}
+
+	names := make(map[string]bool, len(got))
+	for _, cookie := range got {
+		names[cookie.Name] = true
+	}
+
+	if names["c0"] || names["c9"] || !names["c10"] || !names[fmt.Sprintf("c%d", maxCookiesPerHost+9)] {
+		t.Errorf("Cookies() does NOT evict oldest cookies: %v", got)
+	}
+
+	if len(jar.Cookies(other)) != 1 {
+		t.Errorf("Cookies() for other host = %v", jar.Cookies(other))
+	}
+}
+
+func TestResetCookieJar(t *testing.T) {
+	dir := t.TempDir()
+	conf := gokurou.NewConfiguration(1, 1)
+	conf.Options["built_in.crawler.cookie_jar_db_path"] = filepath.Join(dir, "localdb-%d.sqlite")
+
+	u, _ := url.Parse("http://www.example.com/")
+	for _, gwn := range []int{1, 2} {
+		path := filepath.Join(dir, fmt.Sprintf("localdb-%d.sqlite", gwn))
+		jar, err := openCookieJar(path)
+		if err != nil {
+			t.Fatalf("openCookieJar() = %v", err)
+		}
+
+		// URLFrontierのローカルDBと同じファイルに保存する
+		if _, err := jar.db.Exec("CREATE TABLE crawled_hosts(host TEXT PRIMARY KEY)"); err != nil {
+			t.Fatal(err)
+		}
+		jar.SetCookies(u, []*http.Cookie{{Name: "consent", Value: "yes"}})
+		_ = jar.close()
+	}
+
+	if err := ResetCookieJar(conf); err != nil {
+		t.Fatalf("ResetCookieJar() = %v", err)
+	}
+
+	for _, gwn := range []int{1, 2} {
+		jar, err := openCookieJar(filepath.Join(dir, fmt.Sprintf("localdb-%d.sqlite", gwn)))
+		if err != nil {
+			t.Fatalf("openCookieJar() = %v", err)
+		}
+
+		if got := jar.Cookies(u); len(got) != 0 {
+			t.Errorf("Cookies() = %v after reset", got)
+		}
+
+		var n int
+		if err := jar.db.QueryRow("SELECT COUNT(*) FROM crawled_hosts").Scan(&n); err != nil {
+			t.Errorf("ResetCookieJar() breaks other tables: %v", err)
+		}
+		_ = jar.close()
+	}
+}
@@ -0,0 +1,217 @@
+package crawler
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/murakmii/gokurou/pkg/gokurou"
+)
+
+const (
+	retryMaxAttemptsConfKey = "built_in.crawler.retry.max_attempts"
+	retryDelayConfKey       = "built_in.crawler.retry.delay_sec"
+)
+
+// 取得に失敗した理由の分類
+type failureReason string
+
+const (
+	reasonDNS     failureReason = "dns"
+	reasonConnect failureReason = "connect"
+	reasonTLS     failureReason = "tls"
+	reasonTimeout failureReason = "timeout"
+	reasonReset   failureReason = "reset"
+	reasonHTTP5xx failureReason = "http_5xx"
+	reasonBlocked failureReason = "blocked"
+	reasonProxy   failureReason = "proxy" // プロキシへの接続に失敗した、または正常なプロキシがない
+	reasonOther   failureReason = "other"
+
+	// robots.txtによりクロールできなかった場合の分類
+	reasonDisallowed failureReason = "disallowed"
+	reasonThrottled  failureReason = "throttled"
+
+	// ホストがバックオフ中、または死んだものとみなされているため、取得しなかった場合の分類
+	reasonBackoff failureReason = "backoff"
+
+	// IPアドレスでロックできないまま諦めたため、取得しなかった場合の分類
+	reasonLocked failureReason = "locked"
+)
+
+// 取得に失敗した段階
+type fetchPhase string
+
+const (
+	phaseDNS      fetchPhase = "dns"
+	phaseConnect  fetchPhase = "connect"
+	phaseTLS      fetchPhase = "tls"
+	phaseResponse fetchPhase = "response" // 接続後、レスポンスヘッダーを受け取るまで
+	phaseBody     fetchPhase = "body"
+	phaseRobots   fetchPhase = "robots" // robots.txtの取得、またはそれによる禁止
+)
+
+// 成果物に記録する、クロールに失敗した際の情報
+type fetchFailure struct {
+	Class   failureReason `json:"class"`
+	Phase   fetchPhase    `json:"phase"`
+	Message string        `json:"message,omitempty"`
+}
+
+// リクエストの失敗を、失敗した段階と経過時間と共に表すエラー
+type requestError struct {
+	err     error
+	phase   fetchPhase
+	elapsed float64
+	proxy   *url.URL // プロキシを用いなかった場合はnil
+}
+
+func (e *requestError) Error() string {
+	return e.err.Error()
+}
+
+func (e *requestError) Unwrap() error {
+	return e.err
+}
+
+// リクエストがどの段階まで進んだかを記録する
+// httptraceのフックは別のgoroutineから呼ばれることがあるため、ロックして読み書きする
+type fetchProgress struct {
+	mu    sync.Mutex
+	phase fetchPhase
+	ip    string // 接続先のIPアドレス。リダイレクトした場合は最後の接続先となる
+}
+
+func newFetchProgress() *fetchProgress {
+	return &fetchProgress{phase: phaseDNS}
+}
+
+func (progress *fetchProgress) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(_ httptrace.DNSStartInfo) {
+			progress.set(phaseDNS)
+		},
+		ConnectStart: func(_, _ string) {
+			progress.set(phaseConnect)
+		},
+		TLSHandshakeStart: func() {
+			progress.set(phaseTLS)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			progress.mu.Lock()
+			defer progress.mu.Unlock()
+
+			progress.phase = phaseResponse
+			if addr, ok := info.Conn.RemoteAddr().(*net.TCPAddr); ok {
+				progress.ip = addr.IP.String()
+			}
+		},
+	}
+}
+
+func (progress *fetchProgress) set(phase fetchPhase) {
+	progress.mu.Lock()
+	defer progress.mu.Unlock()
+	progress.phase = phase
+}
+
+func (progress *fetchProgress) current() (fetchPhase, string) {
+	progress.mu.Lock()
+	defer progress.mu.Unlock()
+	return progress.phase, progress.ip
+}
+
+// タイムアウトによるエラーならtrueを返す
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return xerrors.As(err, &netErr) && netErr.Timeout()
+}
+
+// プロキシへの接続に失敗したことによるエラーならtrueを返す
+// HTTPとSOCKS5のいずれのプロキシでも、Opが"proxyconnect"のnet.OpErrorとなる
+func isProxyFailure(err error) bool {
+	var opErr *net.OpError
+	return xerrors.As(err, &opErr) && opErr.Op == "proxyconnect"
+}
+
+// 取得時のエラーを分類し、再試行すれば成功する可能性がある一時的なものかどうかと共に返す
+func classifyError(err error) (failureReason, bool) {
+	// 他のプロキシを用いるか、ヘルスチェックでプロキシが復帰すれば取得できる
+	if xerrors.Is(err, errNoHealthyProxy) || isProxyFailure(err) {
+		return reasonProxy, true
+	}
+
+	var blocked *blockedAddressError
+	if xerrors.As(err, &blocked) {
+		return reasonBlocked, false
+	}
+
+	// 存在しないホスト名は何度試しても解決できない
+	var dnsErr *net.DNSError
+	if xerrors.As(err, &dnsErr) {
+		return reasonDNS, !dnsErr.IsNotFound
+	}
+
+	if isTimeout(err) {
+		return reasonTimeout, true
+	}
+
+	if xerrors.Is(err, syscall.ECONNRESET) || xerrors.Is(err, io.ErrUnexpectedEOF) || xerrors.Is(err, io.EOF) {
+		return reasonReset, true
+	}
+
+	// 証明書の不備等は再試行しても解消しない
+	var recordErr tls.RecordHeaderError
+	var unknownAuthority x509.UnknownAuthorityError
+	var invalidCert x509.CertificateInvalidError
+	var hostnameErr x509.HostnameError
+	if xerrors.As(err, &recordErr) || xerrors.As(err, &unknownAuthority) ||
+		xerrors.As(err, &invalidCert) || xerrors.As(err, &hostnameErr) || strings.Contains(err.Error(), "tls:") {
+		return reasonTLS, false
+	}
+
+	var opErr *net.OpError
+	if xerrors.As(err, &opErr) && opErr.Op == "dial" {
+		return reasonConnect, true
+	}
+
+	return reasonOther, false
+}
+
+// 一時的な失敗をどのように再試行するか
+type retryPolicy struct {
+	maxAttempts int           // 再試行する回数の上限。0なら再試行しない
+	delay       time.Duration // 1回目の再試行までに空ける時間。以降は再試行の度に倍にする
+}
+
+func newRetryPolicy(conf *gokurou.Configuration) *retryPolicy {
+	return &retryPolicy{
+		maxAttempts: conf.OptionAsInt(retryMaxAttemptsConfKey),
+		delay:       time.Duration(conf.OptionAsInt(retryDelayConfKey)) * time.Second,
+	}
+}
+
+// 失敗したクロールを再試行する場合は、再試行するURLを返す。再試行しない場合はnilを返す
+func (policy *retryPolicy) retryOf(popped *gokurou.PoppedURL, transient bool) *gokurou.RetryURL {
+	if !transient || popped.Attempt >= policy.maxAttempts {
+		return nil
+	}
+
+	retried := *popped
+	retried.Attempt++
+
+	delay := policy.delay
+	for i := 1; i < retried.Attempt; i++ {
+		delay *= 2
+	}
+
+	return &gokurou.RetryURL{Popped: &retried, Delay: delay}
+}
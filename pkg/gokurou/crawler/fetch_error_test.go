@@ -0,0 +1,151 @@
+package crawler
+
+import (
+	"crypto/x509"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/murakmii/gokurou/pkg/gokurou"
+	"github.com/murakmii/gokurou/pkg/gokurou/www"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassifyError(t *testing.T) {
+	wrap := func(err error) error {
+		return &url.Error{Op: "Get", URL: "http://example.com/", Err: err}
+	}
+
+	tests := []struct {
+		name          string
+		err           error
+		wantReason    failureReason
+		wantTransient bool
+	}{
+		{
+			name:          "存在しないホスト名",
+			err:           wrap(&net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "example.invalid", IsNotFound: true}}),
+			wantReason:    reasonDNS,
+			wantTransient: false,
+		},
+		{
+			name:          "名前解決の一時的な失敗",
+			err:           wrap(&net.OpError{Op: "dial", Err: &net.DNSError{Err: "server misbehaving", Name: "example.com"}}),
+			wantReason:    reasonDNS,
+			wantTransient: true,
+		},
+		{
+			name:          "タイムアウト",
+			err:           wrap(timeoutError{}),
+			wantReason:    reasonTimeout,
+			wantTransient: true,
+		},
+		{
+			name:          "接続のリセット",
+			err:           wrap(&net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}),
+			wantReason:    reasonReset,
+			wantTransient: true,
+		},
+		{
+			name:          "接続の切断",
+			err:           wrap(io.EOF),
+			wantReason:    reasonReset,
+			wantTransient: true,
+		},
+		{
+			name:          "接続の拒否",
+			err:           wrap(&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}),
+			wantReason:    reasonConnect,
+			wantTransient: true,
+		},
+		{
+			name:          "プロキシへの接続の拒否",
+			err:           wrap(&net.OpError{Op: "proxyconnect", Err: &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}}),
+			wantReason:    reasonProxy,
+			wantTransient: true,
+		},
+		{
+			name:          "正常なプロキシがない",
+			err:           errNoHealthyProxy,
+			wantReason:    reasonProxy,
+			wantTransient: true,
+		},
+		{
+			name:          "不正な証明書",
+			err:           wrap(x509.UnknownAuthorityError{}),
+			wantReason:    reasonTLS,
+			wantTransient: false,
+		},
+		{
+			name:          "アクセスを許可しないIPアドレス",
+			err:           wrap(&net.OpError{Op: "dial", Err: &blockedAddressError{ip: net.IPv4(127, 0, 0, 1)}}),
+			wantReason:    reasonBlocked,
+			wantTransient: false,
+		},
+		{
+			name:          "その他のエラー",
+			err:           xerrors.New("unknown"),
+			wantReason:    reasonOther,
+			wantTransient: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, transient := classifyError(tt.err)
+			if reason != tt.wantReason || transient != tt.wantTransient {
+				t.Errorf("classifyError() = (%s, %v), want = (%s, %v)", reason, transient, tt.wantReason, tt.wantTransient)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_retryOf(t *testing.T) {
+	policy := &retryPolicy{maxAttempts: 3, delay: 10 * time.Second}
+	url, _ := www.SanitizedURLFromString("http://example.com/")
+
+	tests := []struct {
+		name      string
+		attempt   int
+		transient bool
+		want      time.Duration // 再試行しない場合は0
+	}{
+		{name: "初回の一時的な失敗の場合、再試行する", attempt: 0, transient: true, want: 10 * time.Second},
+		{name: "再試行を繰り返す場合、間隔を倍にする", attempt: 2, transient: true, want: 40 * time.Second},
+		{name: "再試行の回数が上限に達した場合、再試行しない", attempt: 3, transient: true, want: 0},
+		{name: "一時的な失敗ではない場合、再試行しない", attempt: 0, transient: false, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			popped := &gokurou.PoppedURL{URL: url, Depth: 1, Attempt: tt.attempt}
+			got := policy.retryOf(popped, tt.transient)
+
+			if tt.want == 0 {
+				if got != nil {
+					t.Errorf("retryOf() = %+v, want = nil", got)
+				}
+				return
+			}
+
+			if got == nil || got.Delay != tt.want || got.Popped.Attempt != tt.attempt+1 || got.Popped.Depth != 1 {
+				t.Errorf("retryOf() = %+v, want delay = %s", got, tt.want)
+			}
+
+			if popped.Attempt != tt.attempt {
+				t.Errorf("retryOf() modified popped url")
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package crawler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+
+	"github.com/murakmii/gokurou/pkg/gokurou"
+)
+
+const (
+	backoffBaseConfKey = "built_in.crawler.backoff.base_sec"
+	backoffMaxConfKey  = "built_in.crawler.backoff.max_sec"
+	deadAfterConfKey   = "built_in.crawler.backoff.dead_after"
+)
+
+// ホスト毎の健全性を管理する
+// エラーやスロットリングが続くホストには指数的に間隔を空けてアクセスし、それでも続く場合は死んだものとみなす
+type hostHealth struct {
+	base      time.Duration
+	max       time.Duration
+	deadAfter int // 連続して失敗した回数がこれに達したら死んだものとみなす。0なら死んだものとはみなさない
+	hosts     *lru.Cache
+	now       func() time.Time
+}
+
+type hostCondition struct {
+	failures int
+	until    time.Time // この時刻まではアクセスしない
+	dead     bool
+}
+
+// 設定からホストの健全性の管理を生成する。バックオフが設定されていない場合はnilを返す
+func newHostHealth(conf *gokurou.Configuration) *hostHealth {
+	base := time.Duration(conf.OptionAsInt(backoffBaseConfKey)) * time.Second
+	if base <= 0 {
+		return nil
+	}
+
+	max := time.Duration(conf.OptionAsInt(backoffMaxConfKey)) * time.Second
+	if max < base {
+		max = base
+	}
+
+	hosts, _ := lru.New(10000)
+	return &hostHealth{
+		base:      base,
+		max:       max,
+		deadAfter: conf.OptionAsInt(deadAfterConfKey),
+		hosts:     hosts,
+		now:       time.Now,
+	}
+}
+
+// ホストにアクセスして良いならtrueを返す
+func (health *hostHealth) available(host string) bool {
+	v, ok := health.hosts.Get(host)
+	if !ok {
+		return true
+	}
+
+	cond := v.(*hostCondition)
+	return !cond.dead && !health.now().Before(cond.until)
+}
+
+// ホストにアクセスできるようになるまでの時間を返す。死んだものとみなしたホストの場合は0を返す
+func (health *hostHealth) waiting(host string) time.Duration {
+	v, ok := health.hosts.Get(host)
+	if !ok {
+		return 0
+	}
+
+	cond := v.(*hostCondition)
+	if cond.dead {
+		return 0
+	}
+
+	if wait := cond.until.Sub(health.now()); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// 1回のクロールの結果をホストの健全性に反映し、次にアクセスするまでに空けるべき時間を返す
+// 失敗していない場合は0を返す
+func (health *hostHealth) observe(host string, record *crawlRecord) time.Duration {
+	if record.errors == 0 && !record.throttled {
+		if record.fetched || record.robotsStatus > 0 {
+			health.hosts.Remove(host)
+		}
+		return 0
+	}
+
+	cond := &hostCondition{}
+	if v, ok := health.hosts.Get(host); ok {
+		cond = v.(*hostCondition)
+	}
+
+	cond.failures++
+	backoff := health.base
+	for i := 1; i < cond.failures && backoff < health.max; i++ {
+		backoff *= 2
+	}
+
+	// Retry-Afterで指定された時間の方が長ければそれに従う
+	if record.retryAfter > backoff {
+		backoff = record.retryAfter
+	}
+
+	if backoff > health.max {
+		backoff = health.max
+	}
+
+	if health.deadAfter > 0 && cond.failures >= health.deadAfter {
+		cond.dead = true
+	}
+
+	cond.until = health.now().Add(backoff)
+	health.hosts.Add(host, cond)
+	return backoff
+}
+
+// スロットリングを示すステータスコードならtrueを返す
+func isThrottled(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable
+}
+
+// Retry-Afterヘッダーの値を解釈し、待つべき時間を返す。解釈できない場合は0を返す
+// 値は秒数かHTTP-dateのいずれか
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return 0
+	}
+
+	if sec, err := strconv.Atoi(value); err == nil {
+		if sec < 0 {
+			return 0
+		}
+		return time.Duration(sec) * time.Second
+	}
+
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+
+	return 0
+}
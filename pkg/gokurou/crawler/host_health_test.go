@@ -0,0 +1,126 @@
+package crawler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/murakmii/gokurou/pkg/gokurou"
+)
+
+func buildHostHealth(now *time.Time) *hostHealth {
+	conf := gokurou.NewConfiguration(1, 1)
+	conf.Options["built_in.crawler.backoff.base_sec"] = 10
+	conf.Options["built_in.crawler.backoff.max_sec"] = 60
+	conf.Options["built_in.crawler.backoff.dead_after"] = 5
+
+	health := newHostHealth(conf)
+	health.now = func() time.Time { return *now }
+	return health
+}
+
+func TestHostHealth_observe(t *testing.T) {
+	tests := []struct {
+		name    string
+		records []*crawlRecord
+		want    time.Duration
+	}{
+		{
+			name:    "成功した場合、バックオフしない",
+			records: []*crawlRecord{{fetched: true}},
+			want:    0,
+		},
+		{
+			name:    "1回失敗した場合、基準の時間だけバックオフする",
+			records: []*crawlRecord{{errors: 1}},
+			want:    10 * time.Second,
+		},
+		{
+			name:    "失敗が続く場合、指数的にバックオフする",
+			records: []*crawlRecord{{errors: 1}, {errors: 1}, {throttled: true}},
+			want:    40 * time.Second,
+		},
+		{
+			name:    "失敗が続いても、最大の時間を超えない",
+			records: []*crawlRecord{{errors: 1}, {errors: 1}, {errors: 1}, {errors: 1}},
+			want:    60 * time.Second,
+		},
+		{
+			name:    "Retry-Afterの方が長い場合、それに従う",
+			records: []*crawlRecord{{throttled: true, retryAfter: 30 * time.Second}},
+			want:    30 * time.Second,
+		},
+		{
+			name:    "成功した場合、失敗の回数をリセットする",
+			records: []*crawlRecord{{errors: 1}, {errors: 1}, {fetched: true}, {errors: 1}},
+			want:    10 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			health := buildHostHealth(&now)
+
+			var got time.Duration
+			for _, record := range tt.records {
+				got = health.observe("example.com", record)
+			}
+
+			if got != tt.want {
+				t.Errorf("observe() = %s, want = %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHostHealth_available(t *testing.T) {
+	now := time.Now()
+	health := buildHostHealth(&now)
+
+	if !health.available("example.com") {
+		t.Errorf("available() = false, want = true")
+	}
+
+	health.observe("example.com", &crawlRecord{errors: 1})
+	if health.available("example.com") {
+		t.Errorf("available() = true, want = false")
+	}
+
+	now = now.Add(10 * time.Second)
+	if !health.available("example.com") {
+		t.Errorf("available() = false, want = true")
+	}
+
+	t.Run("失敗が続いた場合、死んだものとみなしてアクセスしない", func(t *testing.T) {
+		for i := 0; i < 5; i++ {
+			health.observe("example.org", &crawlRecord{errors: 1})
+		}
+
+		now = now.Add(24 * time.Hour)
+		if health.available("example.org") {
+			t.Errorf("available() = true, want = false")
+		}
+	})
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{value: "", want: 0},
+		{value: "120", want: 120 * time.Second},
+		{value: "-1", want: 0},
+		{value: "Tue, 01 Oct 2019 00:05:00 GMT", want: 5 * time.Minute},
+		{value: "Mon, 30 Sep 2019 23:55:00 GMT", want: 0},
+		{value: "soon", want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%s) = %s, want = %s", tt.value, got, tt.want)
+		}
+	}
+}
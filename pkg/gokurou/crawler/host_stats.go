@@ -0,0 +1,274 @@
+package crawler
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	// 1ホストあたりに記録するIPアドレスの数の上限
+	maxRecordedIPs = 10
+)
+
+// ホスト毎のクロールの統計情報
+type HostStats struct {
+	Host         string
+	FirstCrawled time.Time
+	LastCrawled  time.Time
+	Pages        int     // ページを取得できた回数
+	Errors       int     // 通信エラーまたは5xxのステータスコードとなった回数
+	TotalElapsed float64 // ページの取得にかかった時間の合計(秒)
+	Server       string  // 最後に取得したページのServerヘッダー
+	RobotsStatus int     // 最後に取得したrobots.txtのステータスコード。取得できなかった場合は0
+	CrawlDelay   uint    // 最後に取得したrobots.txtのCrawl-Delay
+	IPs          []string
+}
+
+// ホスト毎の統計情報をSQLiteに保存する型
+type hostStatsStore struct {
+	db *sql.DB
+}
+
+func openHostStatsStore(path string) (*hostStatsStore, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to open host stats db: %v", err)
+	}
+
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+
+	query := `CREATE TABLE IF NOT EXISTS host_stats(
+		host TEXT PRIMARY KEY,
+		first_crawled_at INTEGER NOT NULL,
+		last_crawled_at INTEGER NOT NULL,
+		pages INTEGER NOT NULL,
+		errors INTEGER NOT NULL,
+		total_elapsed REAL NOT NULL,
+		server TEXT NOT NULL,
+		robots_status INTEGER NOT NULL,
+		crawl_delay INTEGER NOT NULL,
+		ips TEXT NOT NULL
+	)`
+
+	if _, err := db.Exec(query); err != nil {
+		_ = db.Close()
+		return nil, xerrors.Errorf("failed to setup host stats db: %v", err)
+	}
+
+	return &hostStatsStore{db: db}, nil
+}
+
+// ホストの統計情報を読み込み、updateで更新したものを保存する
+// 1つのストアは1つのworkerからしか更新されないため、読み込みから保存までの間の競合は考慮しない
+func (store *hostStatsStore) update(host string, update func(stats *HostStats)) error {
+	stats, err := store.find(host)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if stats == nil {
+		stats = &HostStats{Host: host, FirstCrawled: now}
+	}
+	stats.LastCrawled = now
+	update(stats)
+
+	_, err = store.db.Exec(
+		"INSERT OR REPLACE INTO host_stats VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		stats.Host,
+		stats.FirstCrawled.Unix(),
+		stats.LastCrawled.Unix(),
+		stats.Pages,
+		stats.Errors,
+		stats.TotalElapsed,
+		stats.Server,
+		stats.RobotsStatus,
+		stats.CrawlDelay,
+		strings.Join(stats.IPs, ","),
+	)
+
+	if err != nil {
+		return xerrors.Errorf("failed to save host stats: %v", err)
+	}
+	return nil
+}
+
+// ホストの統計情報を返す。記録されていない場合はnilを返す
+func (store *hostStatsStore) find(host string) (*HostStats, error) {
+	stats, err := store.query("WHERE host = ?", host)
+	if err != nil || len(stats) == 0 {
+		return nil, err
+	}
+	return stats[0], nil
+}
+
+func (store *hostStatsStore) query(condition string, args ...interface{}) ([]*HostStats, error) {
+	rows, err := store.db.Query("SELECT * FROM host_stats "+condition, args...)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to query host stats: %v", err)
+	}
+	defer rows.Close()
+
+	result := make([]*HostStats, 0)
+	for rows.Next() {
+		var firstCrawled, lastCrawled int64
+		var ips string
+		stats := &HostStats{}
+
+		err := rows.Scan(
+			&stats.Host,
+			&firstCrawled,
+			&lastCrawled,
+			&stats.Pages,
+			&stats.Errors,
+			&stats.TotalElapsed,
+			&stats.Server,
+			&stats.RobotsStatus,
+			&stats.CrawlDelay,
+			&ips,
+		)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to scan host stats: %v", err)
+		}
+
+		stats.FirstCrawled = time.Unix(firstCrawled, 0)
+		stats.LastCrawled = time.Unix(lastCrawled, 0)
+		if len(ips) > 0 {
+			stats.IPs = strings.Split(ips, ",")
+		}
+
+		result = append(result, stats)
+	}
+
+	return result, rows.Err()
+}
+
+func (store *hostStatsStore) close() error {
+	return store.db.Close()
+}
+
+// ページの取得にかかった時間の平均(秒)を返す
+func (stats *HostStats) AverageElapsed() float64 {
+	if stats.Pages == 0 {
+		return 0
+	}
+	return stats.TotalElapsed / float64(stats.Pages)
+}
+
+// 初めて見たIPアドレスであれば記録する
+func (stats *HostStats) addIP(ip string) {
+	if len(ip) == 0 || len(stats.IPs) >= maxRecordedIPs {
+		return
+	}
+
+	for _, seen := range stats.IPs {
+		if seen == ip {
+			return
+		}
+	}
+	stats.IPs = append(stats.IPs, ip)
+}
+
+// 各workerが保存したホスト毎の統計情報を読み込んで返す
+// hostが空でない場合は、そのホストかそのサブドメインの統計情報のみを返す
+func LoadHostStats(paths []string, host string) ([]*HostStats, error) {
+	merged := make(map[string]*HostStats)
+	result := make([]*HostStats, 0)
+	for _, path := range paths {
+		store, err := openHostStatsStore(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var stats []*HostStats
+		if len(host) > 0 {
+			stats, err = store.query("WHERE host = ? OR host LIKE ?", host, "%."+host)
+		} else {
+			stats, err = store.query("")
+		}
+
+		_ = store.close()
+		if err != nil {
+			return nil, err
+		}
+
+		// 同じホストを複数のworkerがクロールしていることがあるため、それらは1つにまとめる
+		for _, st := range stats {
+			if m, ok := merged[st.Host]; ok {
+				m.merge(st)
+			} else {
+				merged[st.Host] = st
+				result = append(result, st)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// 他のworkerが記録した同じホストの統計情報をまとめる
+func (stats *HostStats) merge(other *HostStats) {
+	if other.FirstCrawled.Before(stats.FirstCrawled) {
+		stats.FirstCrawled = other.FirstCrawled
+	}
+
+	if other.LastCrawled.After(stats.LastCrawled) {
+		stats.LastCrawled = other.LastCrawled
+		stats.Server = other.Server
+		stats.RobotsStatus = other.RobotsStatus
+		stats.CrawlDelay = other.CrawlDelay
+	}
+
+	stats.Pages += other.Pages
+	stats.Errors += other.Errors
+	stats.TotalElapsed += other.TotalElapsed
+
+	for _, ip := range other.IPs {
+		stats.addIP(ip)
+	}
+}
+
+// 1回のクロールで得られた、ホストの統計情報に反映する情報
+type crawlRecord struct {
+	robotsStatus int
+	crawlDelay   uint
+	fetched      bool
+	elapsed      float64
+	server       string
+	ip           string
+	errors       int
+
+	throttled  bool          // 429または503が返された
+	retryAfter time.Duration // スロットリングされた際のRetry-After
+}
+
+// レスポンスがスロットリングを示していれば記録する
+func (record *crawlRecord) observeThrottling(resp *http.Response) {
+	if !isThrottled(resp.StatusCode) {
+		return
+	}
+
+	record.throttled = true
+	record.retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+}
+
+func (record *crawlRecord) apply(stats *HostStats) {
+	stats.RobotsStatus = record.robotsStatus
+	stats.CrawlDelay = record.crawlDelay
+	stats.Errors += record.errors
+	stats.addIP(record.ip)
+
+	if record.fetched {
+		stats.Pages++
+		stats.TotalElapsed += record.elapsed
+		stats.Server = record.server
+	}
+}
@@ -0,0 +1,113 @@
+package crawler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHostStatsStore_update(t *testing.T) {
+	store, err := openHostStatsStore(":memory:")
+	if err != nil {
+		panic(err)
+	}
+	defer store.close()
+
+	records := []*crawlRecord{
+		{robotsStatus: 200, crawlDelay: 10, fetched: true, elapsed: 0.2, server: "nginx", ip: "192.0.2.1"},
+		{robotsStatus: 404, crawlDelay: 0, fetched: true, elapsed: 0.4, server: "apache", ip: "192.0.2.2", errors: 1},
+		{robotsStatus: 0, ip: "192.0.2.1", errors: 1},
+	}
+
+	for _, record := range records {
+		if err := store.update("example.com", record.apply); err != nil {
+			t.Errorf("update() = %v", err)
+		}
+	}
+
+	got, err := store.find("example.com")
+	if err != nil || got == nil {
+		t.Errorf("find() = (%+v, %v)", got, err)
+		return
+	}
+
+	if got.Pages != 2 || got.Errors != 2 || got.Server != "apache" || got.RobotsStatus != 0 || got.CrawlDelay != 0 {
+		t.Errorf("find() = %+v", got)
+	}
+
+	if avg := got.AverageElapsed(); avg < 0.29 || avg > 0.31 {
+		t.Errorf("AverageElapsed() = %f, want = 0.3", avg)
+	}
+
+	if len(got.IPs) != 2 || got.IPs[0] != "192.0.2.1" || got.IPs[1] != "192.0.2.2" {
+		t.Errorf("find().IPs = %v, want = [192.0.2.1 192.0.2.2]", got.IPs)
+	}
+
+	if got.FirstCrawled.After(got.LastCrawled) {
+		t.Errorf("find() has invalid crawled time")
+	}
+
+	if none, err := store.find("example.org"); none != nil || err != nil {
+		t.Errorf("find() = (%+v, %v), want = (nil, nil)", none, err)
+	}
+}
+
+func TestLoadHostStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gokurou-host-stats")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+
+	hosts := [][]string{{"example.com", "www.example.com"}, {"example.org", "example.com"}}
+	paths := make([]string, len(hosts))
+	for i, hs := range hosts {
+		paths[i] = filepath.Join(dir, "hosts-"+string(rune('1'+i))+".sqlite")
+		store, err := openHostStatsStore(paths[i])
+		if err != nil {
+			panic(err)
+		}
+
+		for _, host := range hs {
+			if err := store.update(host, (&crawlRecord{fetched: true}).apply); err != nil {
+				panic(err)
+			}
+		}
+		_ = store.close()
+	}
+
+	tests := []struct {
+		host string
+		want int
+	}{
+		{host: "", want: 3},
+		{host: "example.com", want: 2},
+		{host: "example.org", want: 1},
+		{host: "example.net", want: 0},
+	}
+
+	for _, tt := range tests {
+		got, err := LoadHostStats(paths, tt.host)
+		if err != nil {
+			t.Errorf("LoadHostStats(%s) = %v", tt.host, err)
+		}
+
+		if len(got) != tt.want {
+			t.Errorf("len(LoadHostStats(%s)) = %d, want = %d", tt.host, len(got), tt.want)
+		}
+	}
+
+	t.Run("複数のworkerが同じホストを記録している場合、1つにまとめる", func(t *testing.T) {
+		got, err := LoadHostStats(paths, "example.com")
+		if err != nil {
+			panic(err)
+		}
+
+		for _, stats := range got {
+			if stats.Host == "example.com" && stats.Pages != 2 {
+				t.Errorf("LoadHostStats() does NOT merge stats: %+v", stats)
+			}
+		}
+	})
+}
@@ -0,0 +1,202 @@
+package crawler
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/murakmii/gokurou/pkg/gokurou"
+	"github.com/murakmii/gokurou/pkg/gokurou/www"
+)
+
+const (
+	httpSettingsConfKey  = "built_in.crawler.http"
+	httpOverridesConfKey = "built_in.crawler.http_overrides"
+)
+
+// HTTPクライアントの設定
+type HTTPSettings struct {
+	DialTimeout           time.Duration
+	ResponseHeaderTimeout time.Duration
+	Timeout               time.Duration // リダイレクトやボディの読み込みを含む、1回の取得全体のタイムアウト
+
+	MaxConnsPerHost     int
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+
+	MinTLSVersion uint16
+	MaxTLSVersion uint16
+
+	// 証明書の検証に失敗しても取得するならtrue。失敗した理由は成果物に記録する
+	AcceptInvalidCerts bool
+
+	// HTTP/2を試みるならtrue。TLSClientConfigを設定しているため、明示しないとHTTP/1.1のみを用いる
+	EnableHTTP2 bool
+
+	MaxBodySize          int64    // 読み込むボディの最大サイズ(バイト)。0なら制限しない
+	MaxRobotsTxtSize     int64    // 読み込むrobots.txtの最大サイズ(バイト)。0なら制限しない
+	AcceptedContentTypes []string // Content-Typeにいずれかを含むレスポンスのみ解析する。Content-Typeがない場合は常に解析する
+}
+
+// デフォルトの設定を返す
+func DefaultHTTPSettings() *HTTPSettings {
+	return &HTTPSettings{
+		DialTimeout:           3 * time.Second,
+		ResponseHeaderTimeout: 3 * time.Second,
+		Timeout:               5 * time.Second,
+
+		MaxConnsPerHost:     2,
+		MaxIdleConns:        1,
+		MaxIdleConnsPerHost: 1,
+
+		// ESTABLISHEDなsocketの数に如実に影響するので短めに設定する
+		// robots.txt取得後のページ取得まで生きていれば良い
+		IdleConnTimeout: 1 * time.Second,
+
+		MinTLSVersion: tls.VersionSSL30, // SSL 3.0もサポートする
+		MaxTLSVersion: tls.VersionTLS13,
+
+		MaxBodySize:          10 * 1024 * 1024,
+		MaxRobotsTxtSize:     500 * 1024, // RFC 9309でクローラーが解析すべきとされているサイズ
+		AcceptedContentTypes: []string{"text", "html", "xml"},
+	}
+}
+
+// Content-Typeから、レスポンスを解析するべきかどうかを返す
+func (settings *HTTPSettings) accepts(contentType string) bool {
+	if len(contentType) == 0 {
+		return true
+	}
+
+	contentType = strings.ToLower(contentType)
+	for _, accepted := range settings.AcceptedContentTypes {
+		if strings.Contains(contentType, strings.ToLower(accepted)) {
+			return true
+		}
+	}
+	return false
+}
+
+// 取得の種類毎に、読み込むボディの最大サイズを返す
+func (settings *HTTPSettings) maxSizeOf(typ fetchType) int64 {
+	if typ == fetchRobotsTxt {
+		return settings.MaxRobotsTxtSize
+	}
+	return settings.MaxBodySize
+}
+
+// 1つの設定から生成したTransportと、取得の種類毎のクライアント
+type httpClientSet struct {
+	settings  *HTTPSettings
+	transport *http.Transport
+	clients   map[fetchType]*http.Client // リダイレクトのルール以外は共通
+}
+
+// 設定からTransportとクライアントを生成する
+// コネクションを使い回せるよう、Transportは全てのクライアントで共有する
+// クライアントは生成後に変更しないため、並行して用いても安全
+func newHTTPClientSet(settings *HTTPSettings, sanitizer *www.Sanitizer, guard *networkGuard, proxies *proxyPool, jar http.CookieJar) *httpClientSet {
+	transport := &http.Transport{
+		MaxIdleConns:          settings.MaxIdleConns,
+		MaxIdleConnsPerHost:   settings.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       settings.MaxConnsPerHost,
+		DisableCompression:    true, // Accept-Encodingは独自に送信し、展開もdecodingBodyで行う
+		ForceAttemptHTTP2:     settings.EnableHTTP2,
+		ResponseHeaderTimeout: settings.ResponseHeaderTimeout,
+		DialContext: (&net.Dialer{
+			Timeout: settings.DialTimeout,
+			Control: guard.control, // 名前解決後のIPアドレスを検査し、内部ネットワークへのアクセスを防ぐ
+		}).DialContext,
+		TLSClientConfig: &tls.Config{
+			MinVersion:         settings.MinTLSVersion,
+			MaxVersion:         settings.MaxTLSVersion,
+			InsecureSkipVerify: settings.AcceptInvalidCerts,
+		},
+		IdleConnTimeout: settings.IdleConnTimeout,
+	}
+
+	// プロキシを用いる場合、Dialerが接続するのは設定されたプロキシのみとなる
+	// プライベートアドレス等のプロキシにも接続できるよう、接続先の検査はproxyOfでリクエスト先のホストに対して行う
+	if proxies != nil {
+		transport.Proxy = proxies.proxyOf
+		transport.DialContext = (&net.Dialer{Timeout: settings.DialTimeout}).DialContext
+	}
+
+	policies := map[fetchType]func(req *http.Request, via []*http.Request) error{
+		fetchRobotsTxt: robotsTxtRedirectPolicy(sanitizer),
+		fetchPage:      pageRedirectPolicy(sanitizer),
+	}
+
+	clients := make(map[fetchType]*http.Client, len(policies))
+	for typ, policy := range policies {
+		clients[typ] = &http.Client{
+			Transport:     transport,
+			CheckRedirect: policy,
+			Timeout:       settings.Timeout,
+			Jar:           jar,
+		}
+	}
+
+	return &httpClientSet{settings: settings, transport: transport, clients: clients}
+}
+
+// ドメイン毎に設定を上書きできるクライアントの集合
+type httpClientSets struct {
+	base      *httpClientSet
+	overrides map[string]*httpClientSet // 設定を上書きするドメインをキーとする。サブドメインにも適用する
+}
+
+// 設定からクライアントの集合を生成する
+// jarがnilならCookieを保持しない
+func newHTTPClientSets(conf *gokurou.Configuration, sanitizer *www.Sanitizer, guard *networkGuard, proxies *proxyPool, jar http.CookieJar) (*httpClientSets, error) {
+	settings := DefaultHTTPSettings()
+	if option, exists := conf.Options[httpSettingsConfKey]; exists && option != nil {
+		var ok bool
+		if settings, ok = option.(*HTTPSettings); !ok {
+			return nil, xerrors.Errorf("'%s' config expects value as *HTTPSettings", httpSettingsConfKey)
+		}
+	}
+
+	sets := &httpClientSets{
+		base:      newHTTPClientSet(settings, sanitizer, guard, proxies, jar),
+		overrides: make(map[string]*httpClientSet),
+	}
+
+	if option, exists := conf.Options[httpOverridesConfKey]; exists && option != nil {
+		overrides, ok := option.(map[string]*HTTPSettings)
+		if !ok {
+			return nil, xerrors.Errorf("'%s' config expects value as map[string]*HTTPSettings", httpOverridesConfKey)
+		}
+
+		for domain, settings := range overrides {
+			sets.overrides[strings.ToLower(domain)] = newHTTPClientSet(settings, sanitizer, guard, proxies, jar)
+		}
+	}
+
+	return sets, nil
+}
+
+// ホスト名に適用するクライアントを返す。複数のドメインに該当する場合は最も長いドメインのものを優先する
+func (sets *httpClientSets) forHost(hostname string) *httpClientSet {
+	found := sets.base
+	matched := ""
+	for domain, set := range sets.overrides {
+		if (hostname == domain || strings.HasSuffix(hostname, "."+domain)) && len(domain) > len(matched) {
+			found = set
+			matched = domain
+		}
+	}
+	return found
+}
+
+func (sets *httpClientSets) closeIdleConnections() {
+	sets.base.transport.CloseIdleConnections()
+	for _, set := range sets.overrides {
+		set.transport.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,88 @@
+package crawler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/murakmii/gokurou/pkg/gokurou"
+)
+
+func TestHTTPSettings_accepts(t *testing.T) {
+	settings := DefaultHTTPSettings()
+	settings.AcceptedContentTypes = []string{"html"}
+
+	tests := []struct {
+		name        string
+		contentType string
+		want        bool
+	}{
+		{name: "Content-Typeがない場合、解析する", contentType: "", want: true},
+		{name: "許可したContent-Typeを含む場合、解析する", contentType: "text/HTML; charset=utf-8", want: true},
+		{name: "許可したContent-Typeを含まない場合、解析しない", contentType: "text/plain", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := settings.accepts(tt.contentType); got != tt.want {
+				t.Errorf("accepts(%s) = %v, want = %v", tt.contentType, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPClientSets_forHost(t *testing.T) {
+	base := DefaultHTTPSettings()
+	slow := DefaultHTTPSettings()
+	slow.Timeout = 30 * time.Second
+	slower := DefaultHTTPSettings()
+	slower.Timeout = 60 * time.Second
+
+	conf := gokurou.NewConfiguration(1, 1)
+	conf.Options["built_in.crawler.http"] = base
+	conf.Options["built_in.crawler.http_overrides"] = map[string]*HTTPSettings{
+		"example.com":         slow,
+		"archive.example.com": slower,
+	}
+
+	guard, _ := newNetworkGuard(nil)
+	sets, err := newHTTPClientSets(conf, conf.Sanitizer(), guard, nil, nil)
+	if err != nil {
+		t.Fatalf("newHTTPClientSets() = %v", err)
+	}
+	defer sets.closeIdleConnections()
+
+	tests := []struct {
+		name     string
+		hostname string
+		want     *HTTPSettings
+	}{
+		{name: "上書きしていないドメインの場合、基本の設定を用いる", hostname: "www.example.net", want: base},
+		{name: "上書きしたドメインの場合、その設定を用いる", hostname: "example.com", want: slow},
+		{name: "上書きしたドメインのサブドメインの場合、その設定を用いる", hostname: "www.example.com", want: slow},
+		{name: "複数のドメインに該当する場合、最も長いドメインの設定を用いる", hostname: "old.archive.example.com", want: slower},
+		{name: "ドメインの途中で一致するだけの場合、基本の設定を用いる", hostname: "badexample.com", want: base},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := sets.forHost(tt.hostname)
+			if set.settings != tt.want {
+				t.Errorf("forHost(%s) returns unexpected settings", tt.hostname)
+			}
+
+			if set.clients[fetchPage].Timeout != tt.want.Timeout {
+				t.Errorf("forHost(%s) returns client with unexpected timeout", tt.hostname)
+			}
+		})
+	}
+}
+
+func TestNewHTTPClientSets(t *testing.T) {
+	conf := gokurou.NewConfiguration(1, 1)
+	conf.Options["built_in.crawler.http"] = "invalid"
+
+	guard, _ := newNetworkGuard(nil)
+	if _, err := newHTTPClientSets(conf, conf.Sanitizer(), guard, nil, nil); err == nil {
+		t.Errorf("newHTTPClientSets() does NOT return error for invalid option")
+	}
+}
@@ -0,0 +1,149 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"syscall"
+
+	"golang.org/x/xerrors"
+)
+
+// クロールの対象としてアクセスすることを許可しないIPアドレスの範囲
+// ループバック, リンクローカル(169.254.169.254のようなメタデータエンドポイントを含む), プライベート, 予約済みのアドレスが該当する
+var blockedNetworks = mustParseCIDRs([]string{
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.0.2.0/24",
+	"192.88.99.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"64:ff9b::/96",
+	"100::/64",
+	"2001::/23",
+	"2001:db8::/32",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+})
+
+// 名前解決後の接続先IPアドレスを検査し、内部ネットワークへのアクセスを防ぐ型
+type networkGuard struct {
+	allowed []*net.IPNet // blockedNetworksに含まれていても例外的に許可する範囲
+}
+
+// アクセスを許可しないIPアドレスへの接続を試みた際のエラー
+type blockedAddressError struct {
+	ip net.IP
+}
+
+func newNetworkGuard(allowedCIDRs []string) (*networkGuard, error) {
+	allowed, err := parseCIDRs(allowedCIDRs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &networkGuard{allowed: allowed}, nil
+}
+
+// net.DialerのControlとして用いる
+// 名前解決の後、実際に接続する直前に呼び出されるため、リダイレクト先やDNS Rebindingによる接続も検査できる
+func (guard *networkGuard) control(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return xerrors.Errorf("invalid address: %s", address)
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return xerrors.Errorf("invalid address: %s", address)
+	}
+
+	if !guard.permits(ip) {
+		return &blockedAddressError{ip: ip}
+	}
+
+	return nil
+}
+
+// ホスト名を名前解決し、全てのIPアドレスへのアクセスを許可する場合のみnilを返す
+// 接続を自身で行わないプロキシ経由のリクエストで用いる
+func (guard *networkGuard) checkHost(ctx context.Context, host string) error {
+	if ip := net.ParseIP(host); ip != nil {
+		if !guard.permits(ip) {
+			return &blockedAddressError{ip: ip}
+		}
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return err
+	}
+
+	for _, addr := range addrs {
+		if !guard.permits(addr.IP) {
+			return &blockedAddressError{ip: addr.IP}
+		}
+	}
+
+	return nil
+}
+
+// IPアドレスへのアクセスを許可するかどうかを返す
+func (guard *networkGuard) permits(ip net.IP) bool {
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4 // IPv4射影アドレスもIPv4アドレスとして検査する
+	}
+
+	for _, network := range guard.allowed {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (e *blockedAddressError) Error() string {
+	return fmt.Sprintf("access to blocked address: %s", e.ip)
+}
+
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid CIDR: %s", cidr)
+		}
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+func mustParseCIDRs(cidrs []string) []*net.IPNet {
+	networks, err := parseCIDRs(cidrs)
+	if err != nil {
+		panic(err)
+	}
+
+	return networks
+}
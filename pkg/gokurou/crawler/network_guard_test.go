@@ -0,0 +1,64 @@
+package crawler
+
+import (
+	"net"
+	"testing"
+)
+
+func TestNetworkGuard_permits(t *testing.T) {
+	guard, err := newNetworkGuard([]string{"10.1.0.0/16"})
+	if err != nil {
+		panic(err)
+	}
+
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{in: "93.184.216.34", want: true},
+		{in: "2606:2800:220:1:248:1893:25c8:1946", want: true},
+		{in: "127.0.0.1", want: false},
+		{in: "10.0.0.5", want: false},
+		{in: "172.16.3.4", want: false},
+		{in: "192.168.0.1", want: false},
+		{in: "169.254.169.254", want: false},
+		{in: "0.0.0.0", want: false},
+		{in: "::1", want: false},
+		{in: "fe80::1", want: false},
+		{in: "fd00::1", want: false},
+		{in: "::ffff:169.254.169.254", want: false},
+		{in: "10.1.2.3", want: true},
+	}
+
+	for _, tt := range tests {
+		got := guard.permits(net.ParseIP(tt.in))
+		if got != tt.want {
+			t.Errorf("permits(%s) = %v, want = %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNetworkGuard_control(t *testing.T) {
+	guard, err := newNetworkGuard(nil)
+	if err != nil {
+		panic(err)
+	}
+
+	if err := guard.control("tcp", "93.184.216.34:80", nil); err != nil {
+		t.Errorf("control(93.184.216.34:80) = %v, want = no error", err)
+	}
+
+	if err := guard.control("tcp", "169.254.169.254:80", nil); err == nil {
+		t.Errorf("control(169.254.169.254:80) = nil, want = error")
+	}
+
+	if err := guard.control("tcp", "[::1]:443", nil); err == nil {
+		t.Errorf("control([::1]:443) = nil, want = error")
+	}
+}
+
+func TestNewNetworkGuard(t *testing.T) {
+	if _, err := newNetworkGuard([]string{"invalid"}); err == nil {
+		t.Errorf("newNetworkGuard([invalid]) = nil, want = error")
+	}
+}
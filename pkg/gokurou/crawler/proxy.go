@@ -0,0 +1,214 @@
+package crawler
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/murakmii/gokurou/pkg/gokurou"
+)
+
+const (
+	proxyURLsConfKey           = "built_in.crawler.proxy.urls"
+	proxyRotationConfKey       = "built_in.crawler.proxy.rotation"
+	proxyHealthCheckIntConfKey = "built_in.crawler.proxy.health_check_interval_sec"
+)
+
+// プロキシの割り当て方
+type proxyRotation string
+
+const (
+	rotateByGWN        proxyRotation = "gwn"         // ワーカー毎に固定のプロキシを用いる
+	rotateByRoundRobin proxyRotation = "round_robin" // リクエスト毎に順に用いる
+)
+
+// 正常なプロキシが1つもない場合のエラー
+var errNoHealthyProxy = xerrors.New("no healthy proxy")
+
+type proxyContextKey struct{}
+
+// クロールに用いるHTTP/SOCKS5プロキシの集合
+// 接続に失敗したプロキシは正常でないものとして扱い、定期的なヘルスチェックで接続できれば再び用いる
+type proxyPool struct {
+	proxies  []*proxyEntry
+	rotation proxyRotation
+	gwn      uint16
+	next     uint32
+	guard    *networkGuard
+	timeout  time.Duration // ヘルスチェックで接続を待つ時間
+	interval time.Duration // ヘルスチェックの間隔。0なら定期的にはヘルスチェックしない
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+type proxyEntry struct {
+	url     *url.URL
+	healthy int32 // 正常なら1。並行してアクセスされるためatomicに読み書きする
+}
+
+// 設定からプロキシの集合を生成する。プロキシが設定されていない場合はnilを返す
+func newProxyPool(conf *gokurou.Configuration, gwn uint16, guard *networkGuard) (*proxyPool, error) {
+	rawURLs, err := conf.OptionAsStrings(proxyURLsConfKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rawURLs) == 0 {
+		return nil, nil
+	}
+
+	proxies := make([]*proxyEntry, 0, len(rawURLs))
+	for _, rawURL := range rawURLs {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid proxy url: %s", rawURL)
+		}
+
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, xerrors.Errorf("unsupported proxy scheme: %s", rawURL)
+		}
+
+		proxies = append(proxies, &proxyEntry{url: u, healthy: 1})
+	}
+
+	rotation := rotateByGWN
+	if r := conf.OptionAsString(proxyRotationConfKey); r != nil && len(*r) > 0 {
+		switch rotation = proxyRotation(*r); rotation {
+		case rotateByGWN, rotateByRoundRobin:
+		default:
+			return nil, xerrors.Errorf("invalid proxy rotation: %s", *r)
+		}
+	}
+
+	return &proxyPool{
+		proxies:  proxies,
+		rotation: rotation,
+		gwn:      gwn,
+		guard:    guard,
+		timeout:  3 * time.Second,
+		interval: time.Duration(conf.OptionAsInt(proxyHealthCheckIntConfKey)) * time.Second,
+		stop:     make(chan struct{}),
+	}, nil
+}
+
+// リクエストに用いるプロキシを選ぶ。割り当てられたプロキシが正常でない場合は、次の正常なものを選ぶ
+// プロキシを用いない(poolがnilの)場合はnilを返す
+func (pool *proxyPool) pick() (*url.URL, error) {
+	if pool == nil {
+		return nil, nil
+	}
+
+	start := int(pool.gwn)
+	if pool.rotation == rotateByRoundRobin {
+		start = int(atomic.AddUint32(&pool.next, 1) - 1)
+	}
+
+	for i := 0; i < len(pool.proxies); i++ {
+		entry := pool.proxies[(start+i)%len(pool.proxies)]
+		if atomic.LoadInt32(&entry.healthy) == 1 {
+			return entry.url, nil
+		}
+	}
+
+	return nil, errNoHealthyProxy
+}
+
+// プロキシを正常でないものとして扱う
+func (pool *proxyPool) markUnhealthy(u *url.URL) {
+	for _, entry := range pool.proxies {
+		if entry.url == u {
+			atomic.StoreInt32(&entry.healthy, 0)
+		}
+	}
+}
+
+// 全てのプロキシに接続できるかを確かめ、正常かどうかを更新する
+func (pool *proxyPool) checkHealth() {
+	for _, entry := range pool.proxies {
+		healthy := int32(0)
+		conn, err := net.DialTimeout("tcp", proxyAddress(entry.url), pool.timeout)
+		if err == nil {
+			_ = conn.Close()
+			healthy = 1
+		}
+		atomic.StoreInt32(&entry.healthy, healthy)
+	}
+}
+
+// 定期的なヘルスチェックを開始する
+func (pool *proxyPool) start() {
+	pool.checkHealth()
+	if pool.interval <= 0 {
+		return
+	}
+
+	pool.wg.Add(1)
+	go func() {
+		defer pool.wg.Done()
+
+		ticker := time.NewTicker(pool.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				pool.checkHealth()
+			case <-pool.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (pool *proxyPool) close() {
+	close(pool.stop)
+	pool.wg.Wait()
+}
+
+// http.TransportのProxyとして用いる。requestで選んだプロキシをコンテキストから取り出す
+// プロキシ経由の場合、Dialerはプロキシへの接続を検査しないため、ここで接続先のホストを検査する
+// 検査されないまま直接接続することがないよう、プロキシが選ばれていないリクエストはエラーとする
+func (pool *proxyPool) proxyOf(req *http.Request) (*url.URL, error) {
+	u, ok := req.Context().Value(proxyContextKey{}).(*url.URL)
+	if !ok {
+		return nil, xerrors.New("proxy is not picked for request")
+	}
+
+	if err := pool.guard.checkHost(req.Context(), req.URL.Hostname()); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+func withProxy(ctx context.Context, u *url.URL) context.Context {
+	return context.WithValue(ctx, proxyContextKey{}, u)
+}
+
+// 成果物に記録するプロキシの表記。認証情報は含めない
+func proxyName(u *url.URL) string {
+	return u.Scheme + "://" + u.Host
+}
+
+func proxyAddress(u *url.URL) string {
+	if len(u.Port()) > 0 {
+		return u.Host
+	}
+
+	port := "1080"
+	switch u.Scheme {
+	case "http":
+		port = "80"
+	case "https":
+		port = "443"
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
@@ -0,0 +1,133 @@
+package crawler
+
+import (
+	"net"
+	"testing"
+
+	"github.com/murakmii/gokurou/pkg/gokurou"
+)
+
+func buildProxyPool(gwn uint16, rotation string, urls ...string) *proxyPool {
+	conf := gokurou.NewConfiguration(1, 1)
+	conf.Options["built_in.crawler.proxy.urls"] = urls
+	conf.Options["built_in.crawler.proxy.rotation"] = rotation
+
+	guard, _ := newNetworkGuard(nil)
+	pool, err := newProxyPool(conf, gwn, guard)
+	if err != nil {
+		panic(err)
+	}
+	return pool
+}
+
+func TestProxyPool_pick(t *testing.T) {
+	urls := []string{"http://proxy1:8080", "http://proxy2:8080", "socks5://proxy3:1080"}
+
+	tests := []struct {
+		name      string
+		gwn       uint16
+		rotation  string
+		unhealthy []int
+		want      []string
+	}{
+		{
+			name:     "GWN毎に割り当てる場合、常に同じプロキシを用いる",
+			gwn:      4,
+			rotation: "gwn",
+			want:     []string{"proxy2:8080", "proxy2:8080", "proxy2:8080"},
+		},
+		{
+			name:     "ラウンドロビンの場合、順に用いる",
+			rotation: "round_robin",
+			want:     []string{"proxy1:8080", "proxy2:8080", "proxy3:1080", "proxy1:8080"},
+		},
+		{
+			name:      "正常でないプロキシは用いない",
+			rotation:  "round_robin",
+			unhealthy: []int{1},
+			want:      []string{"proxy1:8080", "proxy3:1080", "proxy3:1080", "proxy1:8080"},
+		},
+		{
+			name:      "正常なプロキシがない場合、エラーを返す",
+			rotation:  "gwn",
+			unhealthy: []int{0, 1, 2},
+			want:      []string{""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := buildProxyPool(tt.gwn, tt.rotation, urls...)
+			for _, i := range tt.unhealthy {
+				pool.markUnhealthy(pool.proxies[i].url)
+			}
+
+			for _, want := range tt.want {
+				got, err := pool.pick()
+				if len(want) == 0 {
+					if err != errNoHealthyProxy {
+						t.Errorf("pick() = %v, want = %v", err, errNoHealthyProxy)
+					}
+					continue
+				}
+
+				if err != nil || got.Host != want {
+					t.Errorf("pick() = (%v, %v), want = %s", got, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestProxyPool_checkHealth(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	defer listener.Close()
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	closed.Close()
+
+	pool := buildProxyPool(0, "gwn", "http://"+closed.Addr().String(), "http://"+listener.Addr().String())
+	pool.checkHealth()
+
+	got, err := pool.pick()
+	if err != nil || got.Host != listener.Addr().String() {
+		t.Errorf("pick() = (%v, %v), want = %s", got, err, listener.Addr())
+	}
+}
+
+func TestNewProxyPool(t *testing.T) {
+	tests := []struct {
+		name     string
+		urls     []string
+		rotation string
+		wantErr  bool
+	}{
+		{name: "プロキシが設定されていない場合、nilを返す", urls: nil},
+		{name: "対応していないスキームの場合、エラーを返す", urls: []string{"ftp://proxy:21"}, wantErr: true},
+		{name: "不正な割り当て方の場合、エラーを返す", urls: []string{"http://proxy:8080"}, rotation: "random", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := gokurou.NewConfiguration(1, 1)
+			conf.Options["built_in.crawler.proxy.urls"] = tt.urls
+			conf.Options["built_in.crawler.proxy.rotation"] = tt.rotation
+
+			guard, _ := newNetworkGuard(nil)
+			pool, err := newProxyPool(conf, 1, guard)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newProxyPool() = %v, wantErr = %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && pool != nil {
+				t.Errorf("newProxyPool() returns pool without proxies")
+			}
+		})
+	}
+}
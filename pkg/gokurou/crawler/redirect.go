@@ -0,0 +1,71 @@
+package crawler
+
+import (
+	"net/http"
+
+	"github.com/murakmii/gokurou/pkg/gokurou/www"
+)
+
+// 成果物に記録する、リダイレクトの1回分
+type redirectHop struct {
+	URL      string `json:"url"`
+	Status   int    `json:"status"`
+	Location string `json:"location"`
+}
+
+// 最終的なレスポンスから、辿ったリダイレクトを順に返す
+// リダイレクトを打ち切った場合は、最終的なレスポンスも最後のリダイレクトとして含む
+func redirectChain(resp *http.Response) []*redirectHop {
+	chain := make([]*redirectHop, 0)
+	if isRedirect(resp) {
+		chain = append(chain, newRedirectHop(resp))
+	}
+
+	// Request.Responseは、そのリクエストを発生させたリダイレクトのレスポンス
+	for r := resp.Request; r != nil && r.Response != nil; r = r.Response.Request {
+		chain = append(chain, newRedirectHop(r.Response))
+	}
+
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+
+	return chain
+}
+
+// リダイレクトを打ち切ったレスポンスについて、リダイレクト先が別のホストであればそのURLを返す
+// 別のホストへのリダイレクトは、リダイレクト先を新たなURLとしてURLFrontierに任せる
+func crossHostRedirectTarget(resp *http.Response, sanitizer *www.Sanitizer) *www.SanitizedURL {
+	if !isRedirect(resp) || resp.Request == nil {
+		return nil
+	}
+
+	location, err := resp.Location()
+	if err != nil {
+		return nil
+	}
+
+	from, err := sanitizer.FromURL(resp.Request.URL)
+	if err != nil {
+		return nil
+	}
+
+	to, err := sanitizer.FromURL(location)
+	if err != nil || to.Host() == from.Host() {
+		return nil
+	}
+
+	return to
+}
+
+func isRedirect(resp *http.Response) bool {
+	return resp.StatusCode >= 300 && resp.StatusCode < 400 && len(resp.Header.Get("Location")) > 0
+}
+
+func newRedirectHop(resp *http.Response) *redirectHop {
+	hop := &redirectHop{Status: resp.StatusCode, Location: resp.Header.Get("Location")}
+	if resp.Request != nil {
+		hop.URL = resp.Request.URL.String()
+	}
+	return hop
+}
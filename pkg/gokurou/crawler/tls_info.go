@@ -0,0 +1,75 @@
+package crawler
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"time"
+)
+
+// 成果物に記録する、HTTPSで取得した際のTLSの情報
+type tlsInfo struct {
+	Version     string             `json:"version"`
+	CipherSuite string             `json:"cipher_suite"`
+	Chain       []*certificateInfo `json:"chain"` // サーバーが提示した順の証明書
+
+	// 証明書の検証に失敗した場合のエラー。無効な証明書でも取得する設定の場合のみ記録される
+	VerificationError string `json:"verification_error,omitempty"`
+}
+
+type certificateInfo struct {
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	DNSNames  []string  `json:"dns_names,omitempty"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+}
+
+// TLSの接続状態から、成果物に記録する情報を生成する。HTTPSでない場合はnilを返す
+// 検証を省略して接続した場合は、接続時の設定で改めて検証する
+func tlsInfoOf(state *tls.ConnectionState, config *tls.Config) *tlsInfo {
+	if state == nil {
+		return nil
+	}
+
+	info := &tlsInfo{
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		Chain:       make([]*certificateInfo, 0, len(state.PeerCertificates)),
+	}
+
+	for _, cert := range state.PeerCertificates {
+		info.Chain = append(info.Chain, &certificateInfo{
+			Subject:   cert.Subject.String(),
+			Issuer:    cert.Issuer.String(),
+			DNSNames:  cert.DNSNames,
+			NotBefore: cert.NotBefore,
+			NotAfter:  cert.NotAfter,
+		})
+	}
+
+	if config.InsecureSkipVerify {
+		if err := verifyPeerCertificates(state, config.RootCAs); err != nil {
+			info.VerificationError = err.Error()
+		}
+	}
+
+	return info
+}
+
+func verifyPeerCertificates(state *tls.ConnectionState, roots *x509.CertPool) error {
+	if len(state.PeerCertificates) == 0 {
+		return nil
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       state.ServerName,
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	return err
+}
@@ -3,6 +3,7 @@ package gokurou
 import (
 	"context"
 	"sync"
+	"time"
 
 	"golang.org/x/xerrors"
 
@@ -26,15 +27,58 @@ type Coordinator interface {
 	// (同様のIPアドレスが得られるホスト名を引数とする他のLockByIPAddrOf呼び出しが、一定時間内はfalseを返すようにすること)
 	LockByIPAddrOf(host string) (bool, error)
 
+	// LockByIPAddrOfによるロックを、少なくとも与えられた時間だけ保持するよう延長する
+	// 既にそれより長い時間ロックされている場合は何もしないこと
+	ExtendLockByIPAddrOf(host string, ttl time.Duration) error
+
+	// ページ内容のハッシュ値とSimHashを記録し、同一または類似の内容を持つ他のページが既に記録されていればそれを返す
+	// 重複するページが記録されていない場合はnilを返すこと
+	FindDuplicateContent(url string, contentHash string, simHash uint64) (*DuplicateContent, error)
+
 	// クロール中に発生したデータをリセットし、次のクロール開始に備える。Finish相当の初期化処理も同時に行うこと
 	Reset() error
 }
 
+// 内容が重複するページを表す型
+type DuplicateContent struct {
+	URL  string // 先に記録されていた、重複元のページのURL
+	Near bool   // 完全一致ではなくSimHashが近いことによる重複かどうか
+}
+
 // あるページから発生したURLを表す型
 type SpawnedURL struct {
-	From    *www.SanitizedURL
-	Elapsed float64
-	Spawned []*www.SanitizedURL
+	From     *www.SanitizedURL
+	Depth    int               // 生成元のページの深さ
+	Seed     *www.SanitizedURL // 生成元のページを辿る起点となった初期URL。不明な場合はnil
+	Elapsed  float64
+	Language string // 生成元のページの言語。不明な場合は空文字列
+	Spawned  []*www.SanitizedURL
+}
+
+// あるページに含まれる全てのリンクを表す型
+// リンクグラフの成果物として、URLの集合に追加する際のフィルタより前の時点のリンクをArtifactGathererに渡すために用いる
+type OutLinks struct {
+	From  *www.SanitizedURL
+	Links []*www.Link
+}
+
+// URLの集合から取り出された、クロール対象のURLを表す型
+type PoppedURL struct {
+	URL      *www.SanitizedURL
+	Depth    int               // 初期URLからのリンクの深さ。初期URLは0
+	Referrer *www.SanitizedURL // このURLへのリンクを含んでいたページのURL。初期URLや不明な場合はnil
+	Seed     *www.SanitizedURL // 辿ってきたリンクの起点となった初期URL。不明な場合はnil
+	Attempt  int               // 再試行の回数。初回のクロールでは0
+	Deferred int               // IPアドレスでロックできなかったため、URLの集合に戻された回数
+
+	// IPアドレスでロックできないまま諦めたならtrue。Crawlerはクロールせず、諦めたことを記録すること
+	LockFailed bool
+}
+
+// 一時的な失敗により、時間を空けて再度クロールするべきURLを表す型
+type RetryURL struct {
+	Popped *PoppedURL    // 失敗したクロールの対象。Attemptは再試行の回数を表す
+	Delay  time.Duration // 再試行までに空ける時間
 }
 
 // クロール対象となるURLの集合を扱うための実装を要求するinterface
@@ -48,7 +92,11 @@ type URLFrontier interface {
 	Push(ctx context.Context, spawnedURL *SpawnedURL) error
 
 	// URLの集合からURLを1つ取り出す
-	Pop(ctx context.Context) (*www.SanitizedURL, error)
+	Pop(ctx context.Context) (*PoppedURL, error)
+
+	// クロールに失敗したURLや、IPアドレスでロックできなかったURLを、一定時間後に再びPopされるようURLの集合に戻す
+	// 再試行するURLは、既にクロールしたホストのものであってもPopすること
+	Retry(ctx context.Context, retry *RetryURL) error
 
 	// クロール中に発生したデータをリセットし、次のクロール開始に備える。Finish相当の初期化処理も同時に行うこと
 	Reset() error
@@ -105,7 +153,7 @@ type Crawler interface {
 	// 与えられたURLについてクロールする
 	// このURLで指定される対象と、関連するrobots.txt以外にはアクセスしないこと
 	// 得られた結果はOutputPipelineを通じて外部に送信する
-	Crawl(ctx context.Context, url *www.SanitizedURL, out OutputPipeline) error
+	Crawl(ctx context.Context, popped *PoppedURL, out OutputPipeline) error
 }
 
 // 初期URLを設定する
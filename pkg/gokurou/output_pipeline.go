@@ -11,18 +11,23 @@ type OutputPipeline interface {
 
 	// クロールにより発生したURLの収集。ここで与えられたURLがURLFrontierに渡される
 	OutputCollectedURL(ctx context.Context, spawned *SpawnedURL)
+
+	// 再試行するURLの収集。ここで与えられたURLがURLFrontierに渡される
+	OutputRetryURL(ctx context.Context, retry *RetryURL)
 }
 
 // OutputPipelineの実装
 type outputPipelineImpl struct {
 	artifactCh chan<- interface{}
 	pushCh     chan<- *SpawnedURL
+	retryCh    chan<- *RetryURL
 }
 
-func NewOutputPipeline(artifactCh chan<- interface{}, pushCh chan<- *SpawnedURL) OutputPipeline {
+func NewOutputPipeline(artifactCh chan<- interface{}, pushCh chan<- *SpawnedURL, retryCh chan<- *RetryURL) OutputPipeline {
 	return &outputPipelineImpl{
 		artifactCh: artifactCh,
 		pushCh:     pushCh,
+		retryCh:    retryCh,
 	}
 }
 
@@ -39,3 +44,10 @@ func (out *outputPipelineImpl) OutputCollectedURL(ctx context.Context, spawned *
 	case <-ctx.Done():
 	}
 }
+
+func (out *outputPipelineImpl) OutputRetryURL(ctx context.Context, retry *RetryURL) {
+	select {
+	case out.retryCh <- retry:
+	case <-ctx.Done():
+	}
+}
@@ -25,8 +25,10 @@ import (
 
 const (
 	tldFilterConfKey      = "built_in.url_frontier.tld_filter"
+	languageFilterConfKey = "built_in.url_frontier.language_filter"
 	sharedDBSourceConfKey = "built_in.url_frontier.shared_db_source"
 	localDBPathConfKey    = "built_in.url_frontier.local_db_path"
+	maxDepthConfKey       = "built_in.url_frontier.max_depth"
 
 	noBufferThreshold = 100
 )
@@ -35,7 +37,14 @@ type builtInURLFrontier struct {
 	sharedDB     *sql.DB
 	totalWorkers uint
 	tldFilter    []string
+	langFilter   []string
+	scope        *scope
+	focused      *focusedCrawl
+	sanitizer    *www.Sanitizer
+	maxDepth     int // 初期URLから辿るリンクの深さの上限。0なら制限しない
+	prioritizer  Prioritizer
 	pushBuffer   map[uint][]string
+	pushPriority map[uint]int64
 	pushedCount  map[uint]uint64
 
 	localDB         *sql.DB
@@ -44,16 +53,24 @@ type builtInURLFrontier struct {
 	randomizedOrder func() int64
 
 	poppedHostCache *lru.Cache
+	seedHostCache   *lru.Cache
 }
 
 type Host string
 
+// 登録可能なドメイン(eTLD+1)より前のラベルを"*"に置き換えたものを返す
+// "foo.bar.example.co.jp"なら"*.*.example.co.jp"となる
 func (host Host) Normalize() string {
-	labels := strings.Split(host.String(), ".")
-	for i := len(labels) - 3; i >= 0; i-- {
+	domain := www.RegistrableDomain(host.String())
+	if domain == host.String() {
+		return domain
+	}
+
+	labels := strings.Split(strings.TrimSuffix(host.String(), "."+domain), ".")
+	for i := range labels {
 		labels[i] = "*"
 	}
-	return strings.Join(labels, ".")
+	return strings.Join(labels, ".") + "." + domain
 }
 
 func (host Host) String() string {
@@ -61,18 +78,30 @@ func (host Host) String() string {
 }
 
 func BuiltInURLFrontierProvider(ctx context.Context, conf *gokurou.Configuration) (gokurou.URLFrontier, error) {
-	var tldFilter []string
-	tldFilterValue, exists := conf.Options[tldFilterConfKey]
-	if exists {
+	tldFilter, err := conf.OptionAsStrings(tldFilterConfKey)
+	if err != nil {
+		return nil, err
+	}
+
+	langFilter, err := conf.OptionAsStrings(languageFilterConfKey)
+	if err != nil {
+		return nil, err
+	}
+
+	scope, err := newScope(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	// Prioritizerが設定されていない場合は全てのURLの優先度を0とし、ランダムな順序でPopする
+	var prioritizer Prioritizer
+	if option, exists := conf.Options[prioritizerConfKey]; exists && option != nil {
 		var ok bool
-		tldFilter, ok = tldFilterValue.([]string)
-		if !ok {
-			return nil, xerrors.Errorf("'%s' config expects value as []string", tldFilterConfKey)
+		if prioritizer, ok = option.(Prioritizer); !ok {
+			return nil, xerrors.Errorf("'%s' config expects value as Prioritizer", prioritizerConfKey)
 		}
 	}
 
-	var err error
-
 	sharedDB, err := sql.Open("mysql", conf.MustOptionAsString(sharedDBSourceConfKey))
 	if err != nil {
 		return nil, xerrors.Errorf("failed to connect shared db: %v", err)
@@ -116,6 +145,8 @@ func BuiltInURLFrontierProvider(ctx context.Context, conf *gokurou.Configuration
 		"PRAGMA journal_mode=memory", // ガッツ
 		"PRAGMA synchronous=OFF",
 		"CREATE TABLE IF NOT EXISTS crawled_hosts(host TEXT PRIMARY KEY)",
+		"CREATE TABLE IF NOT EXISTS crawled_urls(url TEXT PRIMARY KEY, host TEXT NOT NULL, depth INTEGER NOT NULL)",
+		"CREATE INDEX IF NOT EXISTS crawled_urls_host_index ON crawled_urls(host)",
 	}
 
 	for _, query := range initialQueries {
@@ -129,50 +160,112 @@ func BuiltInURLFrontierProvider(ctx context.Context, conf *gokurou.Configuration
 
 	// 実装読んだらsizeが負の場合だけエラーになるようだったので無視
 	poppedHostCache, _ := lru.New(1000)
+	seedHostCache, _ := lru.New(10000)
 
 	return &builtInURLFrontier{
 		sharedDB:        sharedDB,
 		totalWorkers:    conf.TotalWorkers(),
 		tldFilter:       tldFilter,
+		langFilter:      langFilter,
+		scope:           scope,
+		focused:         newFocusedCrawl(conf),
+		sanitizer:       conf.Sanitizer(),
+		maxDepth:        conf.OptionAsInt(maxDepthConfKey),
+		prioritizer:     prioritizer,
 		pushBuffer:      make(map[uint][]string),
+		pushPriority:    make(map[uint]int64),
 		pushedCount:     make(map[uint]uint64),
 		localDB:         localDB,
 		localDBPath:     localDBPath,
 		popBuffer:       make([]string, 0),
 		randomizedOrder: randomizedOrder,
 		poppedHostCache: poppedHostCache,
+		seedHostCache:   seedHostCache,
 	}, nil
 }
 
 func (frontier *builtInURLFrontier) Seeding(ctx context.Context, urls []string) error {
 	sanitizedURLs := make([]*www.SanitizedURL, 0, len(urls))
 	for _, url := range urls {
-		s, err := www.SanitizedURLFromString(url)
+		s, err := frontier.sanitizer.FromString(url)
 		if err != nil {
 			continue
 		}
 		sanitizedURLs = append(sanitizedURLs, s)
 	}
 
-	from, _ := www.SanitizedURLFromString("http://localhost")
-	return frontier.Push(ctx, &gokurou.SpawnedURL{
-		From:    from,
-		Spawned: sanitizedURLs,
-	})
+	if frontier.focused != nil {
+		if err := frontier.registerSeedHosts(sanitizedURLs); err != nil {
+			return err
+		}
+	}
+
+	// 初期URLは深さ0とし、それ自身を起点とする
+	from, _ := frontier.sanitizer.FromString("http://localhost")
+	filtered, err := frontier.filterURL(&gokurou.SpawnedURL{From: from, Spawned: sanitizedURLs}, 0)
+	if err != nil {
+		return err
+	}
+
+	entries := make([]*entry, len(filtered))
+	for i, url := range filtered {
+		entries[i] = &entry{url: url.String(), depth: 0, seed: url.String()}
+	}
+
+	return frontier.pushEntries(entries)
 }
 
 func (frontier *builtInURLFrontier) Push(_ context.Context, spawned *gokurou.SpawnedURL) error {
-	filtered := frontier.filterURL(spawned)
-	insertValues := make([]interface{}, 0, len(filtered)*2)
+	if frontier.prioritizer != nil {
+		frontier.prioritizer.Observe(spawned)
+	}
+
+	// 生成されたURLは生成元のページの1つ下の深さとなる
+	depth := spawned.Depth + 1
+	if frontier.maxDepth > 0 && depth > frontier.maxDepth {
+		return nil
+	}
+
+	filtered, err := frontier.filterURL(spawned, depth)
+	if err != nil {
+		return err
+	}
+
+	var seed string
+	if spawned.Seed != nil {
+		seed = spawned.Seed.String()
+	}
+
+	entries := make([]*entry, len(filtered))
+	for i, url := range filtered {
+		entries[i] = &entry{url: url.String(), depth: depth, referrer: spawned.From.String(), seed: seed}
+	}
 
-	for _, url := range filtered {
+	return frontier.pushEntries(entries)
+}
+
+// URLとそれに付随する情報を、処理するべきworker毎に共有DBに格納する
+// 複数のURLをまとめて格納する場合、その中で最も大きい優先度をまとめたものの優先度とする
+func (frontier *builtInURLFrontier) pushEntries(entries []*entry) error {
+	insertValues := make([]interface{}, 0, len(entries)*4)
+
+	for _, e := range entries {
+		url, err := frontier.sanitizer.FromString(e.url)
+		if err != nil {
+			return err
+		}
 		destGWN := frontier.computeDestinationGWN(url)
 
 		if _, ok := frontier.pushBuffer[destGWN]; !ok {
 			frontier.pushBuffer[destGWN] = make([]string, 0, 51)
 		}
 
-		frontier.pushBuffer[destGWN] = append(frontier.pushBuffer[destGWN], url.String())
+		priority := frontier.priorityOf(url, e)
+		if len(frontier.pushBuffer[destGWN]) == 0 || priority > frontier.pushPriority[destGWN] {
+			frontier.pushPriority[destGWN] = priority
+		}
+
+		frontier.pushBuffer[destGWN] = append(frontier.pushBuffer[destGWN], e.String())
 		frontier.pushedCount[destGWN]++
 
 		var threshold int
@@ -184,7 +277,7 @@ func (frontier *builtInURLFrontier) Push(_ context.Context, spawned *gokurou.Spa
 
 		if len(frontier.pushBuffer[destGWN]) >= threshold {
 			tabJoinedURL := strings.Join(frontier.pushBuffer[destGWN], "\t")
-			insertValues = append(insertValues, destGWN, tabJoinedURL, frontier.randomizedOrder())
+			insertValues = append(insertValues, destGWN, tabJoinedURL, frontier.pushPriority[destGWN], frontier.randomizedOrder())
 
 			frontier.pushBuffer[destGWN] = make([]string, 0, 51)
 		}
@@ -194,24 +287,57 @@ func (frontier *builtInURLFrontier) Push(_ context.Context, spawned *gokurou.Spa
 		return nil
 	}
 
-	placeholders := strings.Repeat("(?, ?, ?),", len(insertValues)/3-1) + "(?, ?, ?)"
-	_, err := frontier.sharedDB.Exec("INSERT INTO urls(gwn, tab_joined_url, randomized_order) VALUES "+placeholders, insertValues...)
-	if err != nil {
-		return err
+	placeholders := strings.Repeat("(?, ?, ?, ?),", len(insertValues)/4-1) + "(?, ?, ?, ?)"
+	_, err := frontier.sharedDB.Exec("INSERT INTO urls(gwn, tab_joined_url, priority, randomized_order) VALUES "+placeholders, insertValues...)
+	return err
+}
+
+// 再試行するURLは、他のURLとまとめずに再試行が可能になる時刻と共に格納する
+func (frontier *builtInURLFrontier) Retry(_ context.Context, retry *gokurou.RetryURL) error {
+	// まだクロールしていないURL(IPアドレスでロックできずに戻されたもの)は、Popしたことの記録を取り消す
+	// 記録はロックできてクロールしたURLについてのみ残り、戻されたURLは改めてPopするかどうかを判定する
+	if retry.Popped.Attempt == 0 {
+		if err := frontier.unmarkPopped(retry.Popped.URL); err != nil {
+			return err
+		}
 	}
 
-	return nil
+	e := entryFromPopped(retry.Popped)
+	availableAt := time.Now().Add(retry.Delay).Unix()
+
+	_, err := frontier.sharedDB.Exec(
+		"INSERT INTO urls(gwn, tab_joined_url, priority, randomized_order, available_at) VALUES (?, ?, ?, ?, ?)",
+		frontier.computeDestinationGWN(retry.Popped.URL),
+		e.String(),
+		frontier.priorityOf(retry.Popped.URL, e),
+		frontier.randomizedOrder(),
+		availableAt,
+	)
+
+	return err
+}
+
+// URLの優先度を返す
+func (frontier *builtInURLFrontier) priorityOf(url *www.SanitizedURL, e *entry) int64 {
+	if frontier.prioritizer == nil {
+		return 0
+	}
+	return frontier.prioritizer.Priority(url, e.depth)
 }
 
-func (frontier *builtInURLFrontier) Pop(ctx context.Context) (*www.SanitizedURL, error) {
+func (frontier *builtInURLFrontier) Pop(ctx context.Context) (*gokurou.PoppedURL, error) {
 	myGWN := uint(gokurou.GWNFromContext(ctx))
 	skipped := 0
 	for {
 		if len(frontier.popBuffer) == 0 {
 			var id int64
 			var tabJoinedURL string
-			query := "SELECT id, tab_joined_url FROM urls WHERE gwn = ? ORDER BY randomized_order LIMIT 1"
-			err := frontier.sharedDB.QueryRow(query, gokurou.GWNFromContext(ctx)).Scan(&id, &tabJoinedURL)
+			// 優先度の高いものから取り出す。同じ優先度の中ではランダムな順序となる
+			// (インデックスを逆順に走査できるよう、randomized_orderも降順にしている)
+			// 再試行を待っているURLは、再試行が可能になるまで取り出さない
+			// (available_atはインデックスの末尾に含めているので、インデックスを走査しながらテーブルを読まずに読み飛ばせる)
+			query := "SELECT id, tab_joined_url FROM urls WHERE gwn = ? AND available_at <= ? ORDER BY priority DESC, randomized_order DESC LIMIT 1"
+			err := frontier.sharedDB.QueryRow(query, gokurou.GWNFromContext(ctx), time.Now().Unix()).Scan(&id, &tabJoinedURL)
 
 			if err == sql.ErrNoRows {
 				return nil, nil
@@ -225,17 +351,51 @@ func (frontier *builtInURLFrontier) Pop(ctx context.Context) (*www.SanitizedURL,
 			frontier.popBuffer = strings.Split(tabJoinedURL, "\t")
 		}
 
-		url, err := www.SanitizedURLFromString(frontier.popBuffer[0])
+		e := parseEntry(frontier.popBuffer[0])
+		url, err := frontier.sanitizer.FromString(e.url)
 		if err != nil {
 			return nil, err
 		}
 
 		frontier.popBuffer = frontier.popBuffer[1:]
+
+		// 振り分け方を変える前に格納したURLは、別のworkerが処理するべきものである場合があるため、振り分け直す
 		if frontier.computeDestinationGWN(url) != myGWN {
-			return nil, xerrors.Errorf("received invalid URL(GWN is invalid): %s", url) // おかしなPushはフェイルファスト
+			if err := frontier.pushEntries([]*entry{e}); err != nil {
+				return nil, err
+			}
+			skipped++
+			continue
+		}
+
+		// 再試行するURLは既にPopしたものなので、ホストやページ単位での判定を行わない
+		if e.attempt > 0 {
+			gokurou.TracerFromContext(ctx).TracePopSkipped(ctx, skipped)
+			return e.popped(frontier.sanitizer, url), nil
 		}
 
-		host := Host(url.Host())
+		// フォーカスモードでは、初期URLのホストについてはページ単位でPopしたかどうかを判定する
+		if frontier.focused != nil {
+			seed, err := frontier.isSeedHost(url.Hostname())
+			if err != nil {
+				return nil, err
+			}
+
+			if seed {
+				ok, err := frontier.popInSite(url, e)
+				if err != nil {
+					return nil, err
+				} else if !ok {
+					skipped++
+					continue
+				}
+
+				gokurou.TracerFromContext(ctx).TracePopSkipped(ctx, skipped)
+				return e.popped(frontier.sanitizer, url), nil
+			}
+		}
+
+		host := Host(url.Hostname())
 		popped, err := frontier.isAlreadyPoppedHost(host)
 		if err != nil {
 			return nil, err
@@ -249,7 +409,7 @@ func (frontier *builtInURLFrontier) Pop(ctx context.Context) (*www.SanitizedURL,
 		}
 
 		gokurou.TracerFromContext(ctx).TracePopSkipped(ctx, skipped)
-		return url, nil
+		return e.popped(frontier.sanitizer, url), nil
 	}
 }
 
@@ -269,12 +429,13 @@ func (frontier *builtInURLFrontier) Finish() error {
 }
 
 func (frontier *builtInURLFrontier) Reset() error {
-	_, err := frontier.sharedDB.Exec("TRUNCATE urls")
-	if err != nil {
-		return err
+	for _, table := range []string{"urls", "seed_hosts"} {
+		if _, err := frontier.sharedDB.Exec("TRUNCATE " + table); err != nil {
+			return err
+		}
 	}
 
-	if err = frontier.Finish(); err != nil {
+	if err := frontier.Finish(); err != nil {
 		return err
 	}
 
@@ -288,6 +449,30 @@ func (frontier *builtInURLFrontier) Reset() error {
 	return nil
 }
 
+// Popした際の記録を取り消す
+// フォーカスモードの初期URLのホストのページはページ単位で、それ以外はホスト単位で記録しているため、Popした際と同様に判定する
+func (frontier *builtInURLFrontier) unmarkPopped(url *www.SanitizedURL) error {
+	if frontier.focused != nil {
+		seed, err := frontier.isSeedHost(url.Hostname())
+		if err != nil {
+			return err
+		}
+
+		if seed {
+			_, err := frontier.localDB.Exec("DELETE FROM crawled_urls WHERE url = ?", url.String())
+			return err
+		}
+	}
+
+	n := Host(url.Hostname()).Normalize()
+	if _, err := frontier.localDB.Exec("DELETE FROM crawled_hosts WHERE host = ?", n); err != nil {
+		return err
+	}
+
+	frontier.poppedHostCache.Remove(n)
+	return nil
+}
+
 // あるホストについて既にPopしたかどうかを返す
 func (frontier *builtInURLFrontier) isAlreadyPoppedHost(host Host) (bool, error) {
 	n := host.Normalize()
@@ -309,29 +494,35 @@ func (frontier *builtInURLFrontier) isAlreadyPoppedHost(host Host) (bool, error)
 }
 
 // URLから、それを処理するべきworkerのGWNを求める
-// ホスト名のSLDとTLDのハッシュ値から計算する
+// ホスト名の登録可能なドメイン(eTLD+1)のハッシュ値から計算する
 func (frontier *builtInURLFrontier) computeDestinationGWN(url *www.SanitizedURL) uint {
-	sldAndTLD := strings.Split(url.Host(), ".")
-	if len(sldAndTLD) > 2 {
-		sldAndTLD = sldAndTLD[len(sldAndTLD)-2:]
-	}
-
 	// hash.Hash32のWriteの実装を読めば分かるが、これは絶対にエラーを返さない
 	hash := fnv.New32a()
-	_, _ = hash.Write([]byte(strings.Join(sldAndTLD, ".")))
+	_, _ = hash.Write([]byte(url.RegistrableDomain()))
 
 	return (uint(hash.Sum32()) % frontier.totalWorkers) + 1
 }
 
 // 収集されたURLを必要なものだけにフィルタする
-func (frontier *builtInURLFrontier) filterURL(spawned *gokurou.SpawnedURL) []*www.SanitizedURL {
+// depthは生成されたURLの深さ
+func (frontier *builtInURLFrontier) filterURL(spawned *gokurou.SpawnedURL, depth int) ([]*www.SanitizedURL, error) {
 	urlPerHost := make(map[string]*www.SanitizedURL)
 
+	// 言語のフィルタに引っかかるページから生成されたURLは全て不要
+	if !frontier.isAvailableLanguage(spawned.Language) {
+		return []*www.SanitizedURL{}, nil
+	}
+
+	if frontier.focused != nil {
+		return frontier.filterFocusedURL(spawned, depth)
+	}
+
 	// * 1ホストあたり1つのURLで良い
 	// * TLDによるフィルタ
+	// * クロールの対象の範囲(scope)によるフィルタ
 	// * 生成元と同じホスト部を持つURLは不要
 	for _, url := range spawned.Spawned {
-		if !frontier.isAvailableURL(url) || spawned.From.Host() == url.Host() {
+		if !frontier.isAvailableURL(url) || !frontier.scope.contains(url) || spawned.From.Host() == url.Host() {
 			continue
 		}
 
@@ -348,20 +539,56 @@ func (frontier *builtInURLFrontier) filterURL(spawned *gokurou.SpawnedURL) []*ww
 		idx++
 	}
 
-	return filtered
+	return filtered, nil
+}
+
+// フォーカスモードにおいて、収集されたURLを必要なものだけにフィルタする
+// 初期URLのホストのURLであれば、生成元と同じホストであっても全て残す
+func (frontier *builtInURLFrontier) filterFocusedURL(spawned *gokurou.SpawnedURL, depth int) ([]*www.SanitizedURL, error) {
+	filtered := make([]*www.SanitizedURL, 0, len(spawned.Spawned))
+	if frontier.focused.maxDepth > 0 && depth > frontier.focused.maxDepth {
+		return filtered, nil
+	}
+
+	seen := make(map[string]struct{}, len(spawned.Spawned))
+	for _, url := range spawned.Spawned {
+		if _, ok := seen[url.String()]; ok || !frontier.isAvailableURL(url) || !frontier.scope.contains(url) {
+			continue
+		}
+		seen[url.String()] = struct{}{}
+
+		seed, err := frontier.isSeedHost(url.Hostname())
+		if err != nil {
+			return nil, err
+		}
+
+		if seed {
+			filtered = append(filtered, url)
+		}
+	}
+
+	return filtered, nil
 }
 
 // URLが有効なものかどうか。今のところ判定の条件はTLDのフィルタに引っかかるかどうかのみ
+// フィルタにはTLD("jp")の他にパブリックサフィックス("co.jp")も指定できる
 func (frontier *builtInURLFrontier) isAvailableURL(url *www.SanitizedURL) bool {
 	if len(frontier.tldFilter) == 0 {
 		return true
 	}
 
 	tld := url.TLD()
+	suffix := url.PublicSuffix()
 	for _, fTLD := range frontier.tldFilter {
-		if fTLD == tld {
+		if fTLD == tld || fTLD == suffix {
 			return true
 		}
 	}
 	return false
 }
+
+// 生成元のページの言語が有効なものかどうか。言語が不明な場合(初期URLを含む)は有効とする
+// (生成元のページ自体の言語はCrawlerが同じ設定で判定し、フィルタに引っかかるページからはURLを収集しない)
+func (frontier *builtInURLFrontier) isAvailableLanguage(lang string) bool {
+	return www.AcceptsLanguage(frontier.langFilter, lang)
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"testing"
+	"time"
 
 	"github.com/sirupsen/logrus"
 
@@ -36,8 +37,10 @@ func buildURLFrontier(ctx context.Context) *builtInURLFrontier {
 	}
 
 	frontier := f.(*builtInURLFrontier)
-	if _, err = frontier.sharedDB.Exec("TRUNCATE urls"); err != nil {
-		panic(err)
+	for _, table := range []string{"urls", "seed_hosts"} {
+		if _, err = frontier.sharedDB.Exec("TRUNCATE " + table); err != nil {
+			panic(err)
+		}
 	}
 
 	var i int64
@@ -90,6 +93,22 @@ func TestHost_Normalize(t *testing.T) {
 			in:   Host("foo.bar.example.com"),
 			want: "*.*.example.com",
 		},
+		{
+			in:   Host("example.co.jp"),
+			want: "example.co.jp",
+		},
+		{
+			in:   Host("foo.example.co.jp"),
+			want: "*.example.co.jp",
+		},
+		{
+			in:   Host("murakmii.github.io"),
+			want: "murakmii.github.io",
+		},
+		{
+			in:   Host("127.0.0.1"),
+			want: "127.0.0.1",
+		},
 	}
 
 	for _, tt := range tests {
@@ -128,12 +147,67 @@ func TestBuiltInURLFrontier_Push(t *testing.T) {
 				panic(err)
 			}
 
-			if pushed != urls[i-1].String() {
+			if parseEntry(pushed).url != urls[i-1].String() {
 				t.Errorf("Push() does NOT push valid url(%s)", urls[i-1].String())
 			}
 		}
 	})
 
+	t.Run("生成されたURLに深さ、参照元、初期URLを付けてPushする", func(t *testing.T) {
+		url := buildRandomHostURL()
+		seed := buildRandomHostURL()
+		spawned := &gokurou.SpawnedURL{
+			From:    buildRandomHostURL(),
+			Depth:   2,
+			Seed:    seed,
+			Spawned: []*www.SanitizedURL{url},
+		}
+
+		if err := frontier.Push(ctx, spawned); err != nil {
+			t.Errorf("Push() = %v", err)
+		}
+
+		var pushed string
+		err := frontier.sharedDB.QueryRow("SELECT tab_joined_url FROM urls WHERE id = (SELECT MAX(id) FROM urls)").Scan(&pushed)
+		if err != nil {
+			panic(err)
+		}
+
+		want := entry{url: url.String(), depth: 3, referrer: spawned.From.String(), seed: seed.String()}
+		if *parseEntry(pushed) != want {
+			t.Errorf("Push() pushed %s, want = %s", pushed, want.String())
+		}
+	})
+
+	t.Run("深さが上限を超える場合、Pushしない", func(t *testing.T) {
+		frontier.maxDepth = 3
+		defer func() { frontier.maxDepth = 0 }()
+
+		var before int
+		if err := frontier.sharedDB.QueryRow("SELECT COUNT(*) FROM urls").Scan(&before); err != nil {
+			panic(err)
+		}
+
+		spawned := &gokurou.SpawnedURL{
+			From:    buildRandomHostURL(),
+			Depth:   3,
+			Spawned: []*www.SanitizedURL{buildRandomHostURL()},
+		}
+
+		if err := frontier.Push(ctx, spawned); err != nil {
+			t.Errorf("Push() = %v", err)
+		}
+
+		var after int
+		if err := frontier.sharedDB.QueryRow("SELECT COUNT(*) FROM urls").Scan(&after); err != nil {
+			panic(err)
+		}
+
+		if after != before {
+			t.Errorf("Push() pushed url over max depth")
+		}
+	})
+
 	/*t.Run("十分にPushしている場合、バッファしてからPushする", func(t *testing.T) {
 		frontier.pushedCount[1] = 999
 		want := make([]string, 50)
@@ -199,6 +273,18 @@ func TestBuiltInURLFrontier_Pop(t *testing.T) {
 			},
 			want: []sql.NullString{{String: "http://www.example.com", Valid: true}, {}},
 		},
+		{
+			name: "優先度が高いURLから返す",
+			setup: func(frontier *builtInURLFrontier) {
+				if _, err := frontier.sharedDB.Exec("INSERT INTO urls(gwn, tab_joined_url, priority, randomized_order) VALUES(1, 'http://example.com', 10, 2)"); err != nil {
+					panic(err)
+				}
+				if _, err := frontier.sharedDB.Exec("INSERT INTO urls(gwn, tab_joined_url, priority, randomized_order) VALUES(1, 'http://foo.com', 20, 1)"); err != nil {
+					panic(err)
+				}
+			},
+			want: []sql.NullString{{String: "http://foo.com", Valid: true}, {String: "http://example.com", Valid: true}, {}},
+		},
 		{
 			name: "複数URLをバッファしつつ返す",
 			setup: func(frontier *builtInURLFrontier) {
@@ -229,12 +315,12 @@ func TestBuiltInURLFrontier_Pop(t *testing.T) {
 				}
 
 				if want.Valid {
-					if got == nil || got.String() != want.String {
-						t.Errorf("Pop() = %s, want = %s", got, want.String)
+					if got == nil || got.URL.String() != want.String {
+						t.Errorf("Pop() = %+v, want = %s", got, want.String)
 					}
 				} else {
 					if got != nil {
-						t.Errorf("Pop() = %s, want = nil", got)
+						t.Errorf("Pop() = %s, want = nil", got.URL)
 					}
 				}
 			}
@@ -244,6 +330,32 @@ func TestBuiltInURLFrontier_Pop(t *testing.T) {
 	}
 }
 
+func TestBuiltInURLFrontier_Pop_Reroute(t *testing.T) {
+	ctx := buildContext()
+	frontier := buildURLFrontier(ctx)
+	defer frontier.Finish()
+
+	// "http://example.jp/xxx"はGWN4のworkerが処理するべきURL
+	frontier.totalWorkers = 10
+	if _, err := frontier.sharedDB.Exec("INSERT INTO urls(gwn, tab_joined_url, randomized_order) VALUES(1, 'http://example.jp/xxx 1', 1)"); err != nil {
+		panic(err)
+	}
+
+	got, err := frontier.Pop(ctx)
+	if got != nil || err != nil {
+		t.Errorf("Pop() = (%+v, %v), want = (nil, nil)", got, err)
+	}
+
+	var tabJoinedURL string
+	if err := frontier.sharedDB.QueryRow("SELECT tab_joined_url FROM urls WHERE gwn = 4").Scan(&tabJoinedURL); err != nil {
+		t.Fatalf("rerouted URL is not found: %v", err)
+	}
+
+	if tabJoinedURL != "http://example.jp/xxx 1 - - 0" {
+		t.Errorf("rerouted URL = %s, want = http://example.jp/xxx 1 - - 0", tabJoinedURL)
+	}
+}
+
 func TestBuiltInURLFrontier_Finish(t *testing.T) {
 	ctx := buildContext()
 	frontier := buildURLFrontier(ctx)
@@ -267,6 +379,8 @@ func TestBuiltInURLFrontier_computeDestinationGWN(t *testing.T) {
 		{in: "https://www.example.net/x", want: 5},
 		{in: "https://example.org/ppp", want: 6},
 		{in: "http://example.com/hoge", want: 9},
+		{in: "http://example.co.jp/", want: 8},
+		{in: "http://foo.example.co.jp/", want: 8},
 	}
 
 	for _, tt := range tests {
@@ -297,7 +411,11 @@ func TestBuiltInURLFrontier_filterURL(t *testing.T) {
 		},
 	}
 
-	got := frontier.filterURL(spawned)
+	got, err := frontier.filterURL(spawned, 1)
+	if err != nil {
+		t.Errorf("filterURL() = %v", err)
+	}
+
 	if len(got) != 2 ||
 		got[0].String() != "http://www.example.com/newhost" ||
 		got[1].String() != "http://www2.example.com/shorter" {
@@ -305,6 +423,175 @@ func TestBuiltInURLFrontier_filterURL(t *testing.T) {
 	}
 }
 
+func TestBuiltInURLFrontier_filterURL_Focused(t *testing.T) {
+	frontier := buildURLFrontier(buildContext())
+	frontier.focused = &focusedCrawl{maxDepth: 2}
+
+	if err := frontier.registerSeedHosts([]*www.SanitizedURL{mustURL("http://example.com")}); err != nil {
+		panic(err)
+	}
+
+	spawned := &gokurou.SpawnedURL{
+		From: mustURL("http://example.com"),
+		Spawned: []*www.SanitizedURL{
+			mustURL("http://example.com/a"),
+			mustURL("http://example.com/b"),
+			mustURL("http://example.com/a"),
+			mustURL("http://other.example.com/"),
+		},
+	}
+
+	got, err := frontier.filterURL(spawned, 2)
+	if err != nil {
+		t.Errorf("filterURL() = %v", err)
+	}
+
+	if len(got) != 2 || got[0].String() != "http://example.com/a" || got[1].String() != "http://example.com/b" {
+		t.Errorf("filterURL() = %+v, want = [http://example.com/a http://example.com/b]", got)
+	}
+
+	got, err = frontier.filterURL(spawned, 3)
+	if err != nil {
+		t.Errorf("filterURL() = %v", err)
+	}
+
+	if len(got) != 0 {
+		t.Errorf("filterURL() = %+v, want = []", got)
+	}
+}
+
+func TestBuiltInURLFrontier_Pop_Focused(t *testing.T) {
+	ctx := buildContext()
+	frontier := buildURLFrontier(ctx)
+	frontier.focused = &focusedCrawl{maxPagesPerSite: 2}
+
+	if err := frontier.registerSeedHosts([]*www.SanitizedURL{mustURL("http://example.com")}); err != nil {
+		panic(err)
+	}
+
+	query := "INSERT INTO urls(gwn, tab_joined_url, randomized_order) VALUES(1, 'http://example.com/ 0\thttp://example.com/ 1\thttp://example.com/a 1\thttp://example.com/b 1', 1)"
+	if _, err := frontier.sharedDB.Exec(query); err != nil {
+		panic(err)
+	}
+
+	want := []string{"http://example.com/", "http://example.com/a", ""}
+	for _, w := range want {
+		got, err := frontier.Pop(ctx)
+		if err != nil {
+			t.Errorf("Pop() = %v", err)
+		}
+
+		if (w == "" && got != nil) || (w != "" && (got == nil || got.URL.String() != w)) {
+			t.Errorf("Pop() = %+v, want = %s", got, w)
+		}
+	}
+
+	depth, found, err := frontier.depthOf(mustURL("http://example.com/a"))
+	if err != nil || !found || depth != 1 {
+		t.Errorf("depthOf() = (%d, %v, %v), want = (1, true, nil)", depth, found, err)
+	}
+
+	// IPアドレスでロックできずに戻されたページは、Popしたことの記録を取り消して改めてPopする
+	// 戻されたページの分だけ上限に空きができるため、上限を超えたページはPopしない
+	retry := &gokurou.RetryURL{Popped: &gokurou.PoppedURL{URL: mustURL("http://example.com/a"), Depth: 1, Deferred: 1}}
+	if err := frontier.Retry(ctx, retry); err != nil {
+		t.Errorf("Retry() = %v", err)
+	}
+
+	if _, found, _ := frontier.depthOf(mustURL("http://example.com/a")); found {
+		t.Errorf("Retry() does NOT unmark deferred page")
+	}
+
+	got, err := frontier.Pop(ctx)
+	if err != nil || got == nil || got.URL.String() != "http://example.com/a" || got.Deferred != 1 {
+		t.Errorf("Pop() = (%+v, %v), want = http://example.com/a", got, err)
+	}
+
+	_ = frontier.Finish()
+}
+
+func TestBuiltInURLFrontier_Retry(t *testing.T) {
+	ctx := buildContext()
+	frontier := buildURLFrontier(ctx)
+	defer frontier.Finish()
+
+	query := "INSERT INTO urls(gwn, tab_joined_url, randomized_order) VALUES(1, 'http://example.com/ 0', 1)"
+	if _, err := frontier.sharedDB.Exec(query); err != nil {
+		panic(err)
+	}
+
+	popped, err := frontier.Pop(ctx)
+	if err != nil || popped == nil {
+		t.Errorf("Pop() = (%+v, %v)", popped, err)
+		return
+	}
+
+	t.Run("再試行が可能になるまでは、Popしない", func(t *testing.T) {
+		retry := &gokurou.RetryURL{Popped: &gokurou.PoppedURL{URL: popped.URL, Attempt: 1}, Delay: time.Hour}
+		if err := frontier.Retry(ctx, retry); err != nil {
+			t.Errorf("Retry() = %v", err)
+		}
+
+		if got, err := frontier.Pop(ctx); got != nil || err != nil {
+			t.Errorf("Pop() = (%+v, %v), want = (nil, nil)", got, err)
+		}
+
+		if _, err := frontier.sharedDB.Exec("TRUNCATE urls"); err != nil {
+			panic(err)
+		}
+	})
+
+	t.Run("再試行が可能になった場合、既にPopしたホストであってもPopする", func(t *testing.T) {
+		retry := &gokurou.RetryURL{Popped: &gokurou.PoppedURL{URL: popped.URL, Depth: 2, Attempt: 1}}
+		if err := frontier.Retry(ctx, retry); err != nil {
+			t.Errorf("Retry() = %v", err)
+		}
+
+		got, err := frontier.Pop(ctx)
+		if err != nil || got == nil || got.URL.String() != popped.URL.String() || got.Depth != 2 || got.Attempt != 1 {
+			t.Errorf("Pop() = (%+v, %v)", got, err)
+		}
+	})
+
+	t.Run("IPアドレスでロックできずに戻されたURLは、Popしたことの記録を取り消して改めてPopする", func(t *testing.T) {
+		retry := &gokurou.RetryURL{Popped: &gokurou.PoppedURL{URL: popped.URL, Deferred: 1}}
+		if err := frontier.Retry(ctx, retry); err != nil {
+			t.Errorf("Retry() = %v", err)
+		}
+
+		if got, _ := frontier.isAlreadyPoppedHost(Host(popped.URL.Hostname())); got {
+			t.Errorf("Retry() does NOT unmark deferred host")
+		}
+
+		got, err := frontier.Pop(ctx)
+		if err != nil || got == nil || got.URL.String() != popped.URL.String() || got.Attempt != 0 || got.Deferred != 1 {
+			t.Errorf("Pop() = (%+v, %v)", got, err)
+		}
+	})
+}
+
+func TestBuiltInURLFrontier_isAvailableLanguage(t *testing.T) {
+	tests := []struct {
+		filter []string
+		in     string
+		want   bool
+	}{
+		{filter: nil, in: "en", want: true},
+		{filter: []string{"ja"}, in: "ja", want: true},
+		{filter: []string{"ja"}, in: "en", want: false},
+		{filter: []string{"ja"}, in: "", want: true},
+	}
+
+	for _, tt := range tests {
+		frontier := &builtInURLFrontier{langFilter: tt.filter}
+
+		got := frontier.isAvailableLanguage(tt.in)
+		if got != tt.want {
+			t.Errorf("isAvailableLanguage(%s) = %v, want = %v", tt.in, got, tt.want)
+		}
+	}
+}
+
 func TestBuiltInURLFrontier_isAlreadyPoppedHost(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -0,0 +1,99 @@
+package url_frontier
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/murakmii/gokurou/pkg/gokurou"
+
+	"github.com/murakmii/gokurou/pkg/gokurou/www"
+)
+
+// 値がないことを表すフィールドの値
+const emptyField = "-"
+
+// 共有DBにタブ区切りで格納する、URLとそれに付随する情報
+// "<URL> <深さ> <参照元のURL> <初期URL> <再試行の回数> <ロックできずに戻された回数(0なら省略)>"のように空白区切りで表現する(サニタイズ済みのURLは空白を含まない)
+type entry struct {
+	url      string
+	depth    int    // 初期URLからのリンクの深さ
+	referrer string // このURLへのリンクを含んでいたページのURL。ない場合は空文字列
+	seed     string // 辿ってきたリンクの起点となった初期URL。不明な場合は空文字列
+	attempt  int    // 再試行の回数。初回のクロールでは0
+	deferred int    // IPアドレスでロックできずにURLの集合に戻された回数
+}
+
+func parseEntry(s string) *entry {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return &entry{}
+	}
+
+	// 付随する情報を持たない古い形式のものは、深さ0の初期URLとして扱う
+	e := &entry{url: fields[0]}
+	if len(fields) > 1 {
+		e.depth, _ = strconv.Atoi(fields[1])
+	}
+
+	if len(fields) > 2 && fields[2] != emptyField {
+		e.referrer = fields[2]
+	}
+
+	if len(fields) > 3 && fields[3] != emptyField {
+		e.seed = fields[3]
+	}
+
+	if len(fields) > 4 {
+		e.attempt, _ = strconv.Atoi(fields[4])
+	}
+
+	if len(fields) > 5 {
+		e.deferred, _ = strconv.Atoi(fields[5])
+	}
+
+	return e
+}
+
+func (e *entry) String() string {
+	s := fmt.Sprintf("%s %d %s %s %d", e.url, e.depth, fieldOrEmpty(e.referrer), fieldOrEmpty(e.seed), e.attempt)
+	if e.deferred > 0 {
+		s += fmt.Sprintf(" %d", e.deferred) // 戻されたことがないなら省略し、以前の形式と同じにする
+	}
+	return s
+}
+
+// 再試行するURLから、それを表すエントリを生成する
+func entryFromPopped(popped *gokurou.PoppedURL) *entry {
+	e := &entry{url: popped.URL.String(), depth: popped.Depth, attempt: popped.Attempt, deferred: popped.Deferred}
+	if popped.Referrer != nil {
+		e.referrer = popped.Referrer.String()
+	}
+
+	if popped.Seed != nil {
+		e.seed = popped.Seed.String()
+	}
+
+	return e
+}
+
+// Popした結果として返す値を生成する。付随する情報のURLが不正な場合はそれを無視する
+func (e *entry) popped(sanitizer *www.Sanitizer, url *www.SanitizedURL) *gokurou.PoppedURL {
+	popped := &gokurou.PoppedURL{URL: url, Depth: e.depth, Attempt: e.attempt, Deferred: e.deferred}
+	if len(e.referrer) > 0 {
+		popped.Referrer, _ = sanitizer.FromString(e.referrer)
+	}
+
+	if len(e.seed) > 0 {
+		popped.Seed, _ = sanitizer.FromString(e.seed)
+	}
+
+	return popped
+}
+
+func fieldOrEmpty(field string) string {
+	if len(field) == 0 {
+		return emptyField
+	}
+	return field
+}
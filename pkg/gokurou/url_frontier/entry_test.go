@@ -0,0 +1,111 @@
+package url_frontier
+
+import (
+	"testing"
+
+	"github.com/murakmii/gokurou/pkg/gokurou"
+	"github.com/murakmii/gokurou/pkg/gokurou/www"
+)
+
+func TestParseEntry(t *testing.T) {
+	tests := []struct {
+		in   string
+		want entry
+	}{
+		{
+			in:   "http://example.com/a 3 http://example.com/ http://example.com/",
+			want: entry{url: "http://example.com/a", depth: 3, referrer: "http://example.com/", seed: "http://example.com/"},
+		},
+		{
+			in:   "http://example.com/a 3 http://example.com/ http://example.com/ 2",
+			want: entry{url: "http://example.com/a", depth: 3, referrer: "http://example.com/", seed: "http://example.com/", attempt: 2},
+		},
+		{
+			in:   "http://example.com/a 3 - - 1 4",
+			want: entry{url: "http://example.com/a", depth: 3, attempt: 1, deferred: 4},
+		},
+		{
+			in:   "http://example.com/ 0 - http://example.com/",
+			want: entry{url: "http://example.com/", depth: 0, seed: "http://example.com/"},
+		},
+		{
+			in:   "http://example.com/ 2",
+			want: entry{url: "http://example.com/", depth: 2},
+		},
+		{
+			in:   "http://example.com/",
+			want: entry{url: "http://example.com/"},
+		},
+		{
+			in:   "",
+			want: entry{},
+		},
+	}
+
+	for _, tt := range tests {
+		got := parseEntry(tt.in)
+		if *got != tt.want {
+			t.Errorf("parseEntry(%s) = %+v, want = %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestEntry_String(t *testing.T) {
+	tests := []struct {
+		in   entry
+		want string
+	}{
+		{
+			in:   entry{url: "http://example.com/a", depth: 2, referrer: "http://example.com/", seed: "http://example.com/"},
+			want: "http://example.com/a 2 http://example.com/ http://example.com/ 0",
+		},
+		{
+			in:   entry{url: "http://example.com/", depth: 0, attempt: 1},
+			want: "http://example.com/ 0 - - 1",
+		},
+		{
+			in:   entry{url: "http://example.com/", depth: 0, deferred: 3},
+			want: "http://example.com/ 0 - - 0 3",
+		},
+	}
+
+	for _, tt := range tests {
+		got := tt.in.String()
+		if got != tt.want {
+			t.Errorf("String() = %s, want = %s", got, tt.want)
+		}
+	}
+}
+
+func TestEntry_popped(t *testing.T) {
+	e := parseEntry("http://example.com/a 1 http://example.com/ http://example.com/ 2")
+	got := e.popped(www.NewSanitizer(nil, nil), mustURL(e.url))
+
+	if got.URL.String() != "http://example.com/a" ||
+		got.Depth != 1 ||
+		got.Attempt != 2 ||
+		got.Referrer.String() != "http://example.com/" ||
+		got.Seed.String() != "http://example.com/" {
+		t.Errorf("popped() = %+v", got)
+	}
+
+	got = parseEntry("http://example.com/").popped(www.NewSanitizer(nil, nil), mustURL("http://example.com/"))
+	if got.Referrer != nil || got.Seed != nil {
+		t.Errorf("popped() = %+v, want referrer and seed are nil", got)
+	}
+}
+
+func TestEntryFromPopped(t *testing.T) {
+	popped := &gokurou.PoppedURL{
+		URL:      mustURL("http://example.com/a"),
+		Depth:    1,
+		Referrer: mustURL("http://example.com/"),
+		Attempt:  2,
+		Deferred: 5,
+	}
+
+	want := entry{url: "http://example.com/a", depth: 1, referrer: "http://example.com/", attempt: 2, deferred: 5}
+	if got := entryFromPopped(popped); *got != want {
+		t.Errorf("entryFromPopped() = %+v, want = %+v", got, want)
+	}
+}
@@ -0,0 +1,103 @@
+package url_frontier
+
+import (
+	"database/sql"
+
+	"github.com/murakmii/gokurou/pkg/gokurou"
+
+	"github.com/murakmii/gokurou/pkg/gokurou/www"
+)
+
+const (
+	focusedConfKey         = "built_in.url_frontier.focused.enabled"
+	maxPagesPerSiteConfKey = "built_in.url_frontier.focused.max_pages_per_site"
+	focusedMaxDepthConfKey = "built_in.url_frontier.focused.max_depth"
+)
+
+// 初期URLのホスト(サイト)の中だけをクロールする際の設定
+// 通常は1ホストにつき1ページしかクロールしないが、このモードではサイト内のリンクを辿ってクロールする
+type focusedCrawl struct {
+	maxPagesPerSite int // サイト毎にクロールするページ数の上限。0なら制限しない
+	maxDepth        int // 初期URLから辿るリンクの深さの上限。0なら制限しない
+}
+
+func newFocusedCrawl(conf *gokurou.Configuration) *focusedCrawl {
+	if !conf.OptionAsBool(focusedConfKey) {
+		return nil
+	}
+
+	return &focusedCrawl{
+		maxPagesPerSite: conf.OptionAsInt(maxPagesPerSiteConfKey),
+		maxDepth:        conf.OptionAsInt(focusedMaxDepthConfKey),
+	}
+}
+
+// 初期URLのホストを、全てのworkerから参照できるよう共有DBに記録する
+func (frontier *builtInURLFrontier) registerSeedHosts(urls []*www.SanitizedURL) error {
+	for _, url := range urls {
+		if _, err := frontier.sharedDB.Exec("INSERT IGNORE INTO seed_hosts VALUES(?)", url.Hostname()); err != nil {
+			return err
+		}
+		frontier.seedHostCache.Add(url.Hostname(), true)
+	}
+
+	return nil
+}
+
+// 初期URLのホストかどうかを返す
+func (frontier *builtInURLFrontier) isSeedHost(hostname string) (bool, error) {
+	if cached, ok := frontier.seedHostCache.Get(hostname); ok {
+		return cached.(bool), nil
+	}
+
+	var tmp sql.NullInt64
+	err := frontier.sharedDB.QueryRow("SELECT 1 FROM seed_hosts WHERE host = ?", hostname).Scan(&tmp)
+	if err != nil && err != sql.ErrNoRows {
+		return false, err
+	}
+
+	seed := err == nil
+	frontier.seedHostCache.Add(hostname, seed)
+	return seed, nil
+}
+
+// Popしたことがあるページについて、その深さを返す
+func (frontier *builtInURLFrontier) depthOf(url *www.SanitizedURL) (int, bool, error) {
+	var depth int
+	err := frontier.localDB.QueryRow("SELECT depth FROM crawled_urls WHERE url = ?", url.String()).Scan(&depth)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+
+	return depth, true, nil
+}
+
+// 初期URLのホストのページをPopしてよいかどうかを判定し、よければPopしたことを記録する
+// 既にPopしたページや、サイト毎のページ数の上限に達したサイトのページはPopしない
+// IPアドレスでロックできずに戻されたページは、Retryで記録を取り消すため改めてPopできる
+func (frontier *builtInURLFrontier) popInSite(url *www.SanitizedURL, e *entry) (bool, error) {
+	if _, crawled, err := frontier.depthOf(url); err != nil || crawled {
+		return false, err
+	}
+
+	if frontier.focused.maxPagesPerSite > 0 {
+		var pages int
+		err := frontier.localDB.QueryRow("SELECT COUNT(*) FROM crawled_urls WHERE host = ?", url.Hostname()).Scan(&pages)
+		if err != nil {
+			return false, err
+		}
+
+		if pages >= frontier.focused.maxPagesPerSite {
+			return false, nil
+		}
+	}
+
+	_, err := frontier.localDB.Exec("INSERT INTO crawled_urls VALUES(?, ?, ?)", url.String(), url.Hostname(), e.depth)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,114 @@
+package url_frontier
+
+import (
+	"math"
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru"
+
+	"github.com/murakmii/gokurou/pkg/gokurou"
+
+	"github.com/murakmii/gokurou/pkg/gokurou/www"
+)
+
+const (
+	prioritizerConfKey = "built_in.url_frontier.prioritizer"
+
+	// 優先度の計算に用いるスコアの精度。スコアをこの値倍して整数に丸めたものを優先度とする
+	// 細かい差を丸めることで、同程度の優先度のURL同士はランダムな順序でPopされホストが分散する
+	priorityScale = 100
+)
+
+// Push時にURLの優先度を計算する実装を要求するinterface
+// 優先度が大きいURLほど先にPopされる。1プロセス中の全workerで共有されるため、競合状態に注意すること
+type Prioritizer interface {
+	// 収集されたURLを観測する。被リンク数のような、URLの集合全体から求める指標の計算に用いる
+	Observe(spawned *gokurou.SpawnedURL)
+
+	// URLの優先度を返す
+	Priority(url *www.SanitizedURL, depth int) int64
+}
+
+// 各指標の重み付き和をスコアとするPrioritizer
+// 被リンク数とホストの被リンク数は、このPrioritizerが観測した範囲での近似値となる
+type WeightedPrioritizer struct {
+	weights   *PriorityWeights
+	mutex     sync.Mutex
+	inLinks   *lru.Cache
+	hostLinks *lru.Cache
+}
+
+// WeightedPrioritizerで用いる各指標の重み
+type PriorityWeights struct {
+	Depth         float64            // 初期URLからの深さが浅いほど高くなる指標の重み
+	InLinks       float64            // URLの被リンク数が多いほど高くなる指標の重み
+	HostAuthority float64            // ホスト(登録可能なドメイン)が他のドメインからリンクされた数が多いほど高くなる指標の重み
+	PathLength    float64            // パスが浅いほど高くなる指標の重み
+	TLDPreference map[string]float64 // TLDまたはパブリックサフィックス毎に加算するスコア
+}
+
+func NewWeightedPrioritizer(weights *PriorityWeights) *WeightedPrioritizer {
+	// 実装読んだらsizeが負の場合だけエラーになるようだったので無視
+	inLinks, _ := lru.New(100000)
+	hostLinks, _ := lru.New(100000)
+
+	return &WeightedPrioritizer{
+		weights:   weights,
+		inLinks:   inLinks,
+		hostLinks: hostLinks,
+	}
+}
+
+func (p *WeightedPrioritizer) Observe(spawned *gokurou.SpawnedURL) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	fromDomain := spawned.From.RegistrableDomain()
+	seen := make(map[string]struct{}, len(spawned.Spawned))
+
+	for _, url := range spawned.Spawned {
+		if _, ok := seen[url.String()]; ok {
+			continue
+		}
+		seen[url.String()] = struct{}{}
+		increment(p.inLinks, url.String())
+
+		// ホストの被リンク数は、1ページにつき1回だけ他のドメインからのリンクを数える
+		domain := url.RegistrableDomain()
+		if _, ok := seen[domain]; !ok && domain != fromDomain {
+			seen[domain] = struct{}{}
+			increment(p.hostLinks, domain)
+		}
+	}
+}
+
+func (p *WeightedPrioritizer) Priority(url *www.SanitizedURL, depth int) int64 {
+	p.mutex.Lock()
+	inLinks := count(p.inLinks, url.String())
+	hostLinks := count(p.hostLinks, url.RegistrableDomain())
+	p.mutex.Unlock()
+
+	score := p.weights.Depth/float64(1+depth) +
+		p.weights.InLinks*math.Log2(float64(1+inLinks)) +
+		p.weights.HostAuthority*math.Log2(float64(1+hostLinks)) +
+		p.weights.PathLength/float64(1+pathDepth(url.Path()))
+
+	if preference, ok := p.weights.TLDPreference[url.PublicSuffix()]; ok {
+		score += preference
+	} else if preference, ok := p.weights.TLDPreference[url.TLD()]; ok {
+		score += preference
+	}
+
+	return int64(math.Round(score * priorityScale))
+}
+
+func increment(cache *lru.Cache, key string) {
+	cache.Add(key, count(cache, key)+1)
+}
+
+func count(cache *lru.Cache, key string) int {
+	if v, ok := cache.Get(key); ok {
+		return v.(int)
+	}
+	return 0
+}
@@ -0,0 +1,90 @@
+package url_frontier
+
+import (
+	"testing"
+
+	"github.com/murakmii/gokurou/pkg/gokurou"
+
+	"github.com/murakmii/gokurou/pkg/gokurou/www"
+)
+
+func TestWeightedPrioritizer_Priority(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights *PriorityWeights
+		in      string
+		depth   int
+		want    int64
+	}{
+		{
+			name:    "浅いURLほど優先度が高い",
+			weights: &PriorityWeights{Depth: 1},
+			in:      "http://example.com/",
+			depth:   1,
+			want:    50,
+		},
+		{
+			name:    "パスが浅いURLほど優先度が高い",
+			weights: &PriorityWeights{PathLength: 1},
+			in:      "http://example.com/a/b/c",
+			depth:   0,
+			want:    25,
+		},
+		{
+			name:    "優先するTLDの場合、スコアを加算する",
+			weights: &PriorityWeights{TLDPreference: map[string]float64{"jp": 0.5}},
+			in:      "http://example.jp/",
+			depth:   0,
+			want:    50,
+		},
+		{
+			name:    "パブリックサフィックスでの指定を優先する",
+			weights: &PriorityWeights{TLDPreference: map[string]float64{"jp": 0.5, "co.jp": 1}},
+			in:      "http://example.co.jp/",
+			depth:   0,
+			want:    100,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewWeightedPrioritizer(tt.weights).Priority(mustURL(tt.in), tt.depth)
+			if got != tt.want {
+				t.Errorf("Priority(%s, %d) = %d, want = %d", tt.in, tt.depth, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWeightedPrioritizer_Observe(t *testing.T) {
+	p := NewWeightedPrioritizer(&PriorityWeights{InLinks: 1, HostAuthority: 1})
+
+	p.Observe(&gokurou.SpawnedURL{
+		From: mustURL("http://foo.com/"),
+		Spawned: []*www.SanitizedURL{
+			mustURL("http://example.com/"),
+			mustURL("http://example.com/"),
+			mustURL("http://www.example.com/a"),
+			mustURL("http://foo.com/b"),
+		},
+	})
+
+	p.Observe(&gokurou.SpawnedURL{
+		From:    mustURL("http://bar.com/"),
+		Spawned: []*www.SanitizedURL{mustURL("http://example.com/")},
+	})
+
+	// 被リンク数2(log2(3))とホストの被リンク数2(log2(3))の和
+	if got := p.Priority(mustURL("http://example.com/"), 0); got != 317 {
+		t.Errorf("Priority(http://example.com/) = %d, want = 317", got)
+	}
+
+	// 同じドメインからのリンクはホストの被リンク数として数えない
+	if got := p.Priority(mustURL("http://foo.com/b"), 0); got != 100 {
+		t.Errorf("Priority(http://foo.com/b) = %d, want = 100", got)
+	}
+
+	if got := p.Priority(mustURL("http://unknown.com/"), 0); got != 0 {
+		t.Errorf("Priority(http://unknown.com/) = %d, want = 0", got)
+	}
+}
@@ -0,0 +1,164 @@
+package url_frontier
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"github.com/murakmii/gokurou/pkg/gokurou"
+
+	"github.com/murakmii/gokurou/pkg/gokurou/www"
+)
+
+const (
+	allowedDomainsConfKey    = "built_in.url_frontier.scope.allowed_domains"
+	deniedDomainsConfKey     = "built_in.url_frontier.scope.denied_domains"
+	includePatternsConfKey   = "built_in.url_frontier.scope.include_patterns"
+	excludePatternsConfKey   = "built_in.url_frontier.scope.exclude_patterns"
+	blockedExtensionsConfKey = "built_in.url_frontier.scope.blocked_extensions"
+	maxPathDepthConfKey      = "built_in.url_frontier.scope.max_path_depth"
+	maxQueryLengthConfKey    = "built_in.url_frontier.scope.max_query_length"
+)
+
+// クロールの対象とするURLの範囲
+// 各項目は設定されていない(空か0)場合は制限しない
+type scope struct {
+	allowedDomains    []string            // 許可するドメイン。サブドメインも許可する
+	deniedDomains     []string            // 拒否するドメイン。サブドメインも拒否し、allowedDomainsより優先する
+	includePatterns   []*regexp.Regexp    // URL全体がいずれかにマッチしなければならない正規表現
+	excludePatterns   []*regexp.Regexp    // URL全体がいずれかにマッチしてはならない正規表現
+	blockedExtensions map[string]struct{} // 拒否するパスの拡張子(".pdf"のように小文字かつドットから始まる形式)
+	maxPathDepth      int                 // パスの最大の深さ("/a/b/c.html"なら3)
+	maxQueryLength    int                 // クエリ部の最大の長さ
+}
+
+func newScope(conf *gokurou.Configuration) (*scope, error) {
+	s := &scope{
+		maxPathDepth:   conf.OptionAsInt(maxPathDepthConfKey),
+		maxQueryLength: conf.OptionAsInt(maxQueryLengthConfKey),
+	}
+
+	var err error
+	if s.allowedDomains, err = domainsOption(conf, allowedDomainsConfKey); err != nil {
+		return nil, err
+	}
+
+	if s.deniedDomains, err = domainsOption(conf, deniedDomainsConfKey); err != nil {
+		return nil, err
+	}
+
+	if s.includePatterns, err = patternsOption(conf, includePatternsConfKey); err != nil {
+		return nil, err
+	}
+
+	if s.excludePatterns, err = patternsOption(conf, excludePatternsConfKey); err != nil {
+		return nil, err
+	}
+
+	exts, err := conf.OptionAsStrings(blockedExtensionsConfKey)
+	if err != nil {
+		return nil, err
+	}
+
+	s.blockedExtensions = make(map[string]struct{}, len(exts))
+	for _, ext := range exts {
+		s.blockedExtensions["."+strings.TrimPrefix(strings.ToLower(ext), ".")] = struct{}{}
+	}
+
+	return s, nil
+}
+
+// URLがクロールの対象の範囲に含まれるかどうかを返す
+func (s *scope) contains(url *www.SanitizedURL) bool {
+	hostname := url.Hostname()
+	if matchDomains(s.deniedDomains, hostname) {
+		return false
+	}
+
+	if len(s.allowedDomains) > 0 && !matchDomains(s.allowedDomains, hostname) {
+		return false
+	}
+
+	if _, blocked := s.blockedExtensions[strings.ToLower(path.Ext(url.Path()))]; blocked {
+		return false
+	}
+
+	if s.maxPathDepth > 0 && pathDepth(url.Path()) > s.maxPathDepth {
+		return false
+	}
+
+	if s.maxQueryLength > 0 && len(url.Query()) > s.maxQueryLength {
+		return false
+	}
+
+	str := url.String()
+	for _, ptn := range s.excludePatterns {
+		if ptn.MatchString(str) {
+			return false
+		}
+	}
+
+	if len(s.includePatterns) == 0 {
+		return true
+	}
+
+	for _, ptn := range s.includePatterns {
+		if ptn.MatchString(str) {
+			return true
+		}
+	}
+	return false
+}
+
+// ホスト名がドメインのいずれかと等しいか、そのサブドメインであるかどうかを返す
+func matchDomains(domains []string, hostname string) bool {
+	for _, domain := range domains {
+		if hostname == domain || strings.HasSuffix(hostname, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// パスの深さ(空でないセグメントの数)を返す
+func pathDepth(p string) int {
+	depth := 0
+	for _, segment := range strings.Split(p, "/") {
+		if len(segment) > 0 {
+			depth++
+		}
+	}
+	return depth
+}
+
+func domainsOption(conf *gokurou.Configuration, key string) ([]string, error) {
+	domains, err := conf.OptionAsStrings(key)
+	if err != nil {
+		return nil, err
+	}
+
+	normalized := make([]string, len(domains))
+	for i, domain := range domains {
+		normalized[i] = strings.TrimPrefix(strings.ToLower(domain), ".")
+	}
+
+	return normalized, nil
+}
+
+func patternsOption(conf *gokurou.Configuration, key string) ([]*regexp.Regexp, error) {
+	strs, err := conf.OptionAsStrings(key)
+	if err != nil {
+		return nil, err
+	}
+
+	patterns := make([]*regexp.Regexp, len(strs))
+	for i, str := range strs {
+		if patterns[i], err = regexp.Compile(str); err != nil {
+			return nil, xerrors.Errorf("invalid pattern in '%s' config: %v", key, err)
+		}
+	}
+
+	return patterns, nil
+}
@@ -0,0 +1,118 @@
+package url_frontier
+
+import (
+	"testing"
+
+	"github.com/murakmii/gokurou/pkg/gokurou"
+)
+
+func TestScope_contains(t *testing.T) {
+	tests := []struct {
+		name    string
+		options map[string]interface{}
+		in      string
+		want    bool
+	}{
+		{
+			name:    "何も設定されていない場合、全てのURLを含む",
+			options: map[string]interface{}{},
+			in:      "http://example.com/a/b/c.pdf?q=1",
+			want:    true,
+		},
+		{
+			name:    "許可するドメインに含まれる場合",
+			options: map[string]interface{}{allowedDomainsConfKey: []string{"example.com"}},
+			in:      "http://www.example.com/",
+			want:    true,
+		},
+		{
+			name:    "許可するドメインに含まれない場合",
+			options: map[string]interface{}{allowedDomainsConfKey: []string{"example.com"}},
+			in:      "http://badexample.com/",
+			want:    false,
+		},
+		{
+			name: "拒否するドメインに含まれる場合、許可するドメインより優先する",
+			options: map[string]interface{}{
+				allowedDomainsConfKey: []string{"example.com"},
+				deniedDomainsConfKey:  []string{"ads.example.com"},
+			},
+			in:   "http://img.ads.example.com/",
+			want: false,
+		},
+		{
+			name:    "拒否する拡張子を持つ場合",
+			options: map[string]interface{}{blockedExtensionsConfKey: []string{"pdf", ".zip"}},
+			in:      "http://example.com/docs/manual.PDF",
+			want:    false,
+		},
+		{
+			name:    "拒否する拡張子を持たない場合",
+			options: map[string]interface{}{blockedExtensionsConfKey: []string{"pdf", ".zip"}},
+			in:      "http://example.com/docs/manual.html",
+			want:    true,
+		},
+		{
+			name:    "パスが深すぎる場合",
+			options: map[string]interface{}{maxPathDepthConfKey: 2},
+			in:      "http://example.com/a/b/c.html",
+			want:    false,
+		},
+		{
+			name:    "パスが十分に浅い場合",
+			options: map[string]interface{}{maxPathDepthConfKey: 2},
+			in:      "http://example.com/a/b/",
+			want:    true,
+		},
+		{
+			name:    "クエリが長すぎる場合",
+			options: map[string]interface{}{maxQueryLengthConfKey: 5},
+			in:      "http://example.com/?q=123456",
+			want:    false,
+		},
+		{
+			name:    "除外する正規表現にマッチする場合",
+			options: map[string]interface{}{excludePatternsConfKey: []string{`/(login|logout)\b`}},
+			in:      "http://example.com/login?next=/",
+			want:    false,
+		},
+		{
+			name:    "含める正規表現にマッチしない場合",
+			options: map[string]interface{}{includePatternsConfKey: []string{`^https://`}},
+			in:      "http://example.com/",
+			want:    false,
+		},
+		{
+			name:    "含める正規表現にマッチする場合",
+			options: map[string]interface{}{includePatternsConfKey: []string{`^https://`}},
+			in:      "https://example.com/",
+			want:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := gokurou.NewConfiguration(1, 1)
+			conf.Options = tt.options
+
+			s, err := newScope(conf)
+			if err != nil {
+				panic(err)
+			}
+
+			got := s.contains(mustURL(tt.in))
+			if got != tt.want {
+				t.Errorf("contains(%s) = %v, want = %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewScope(t *testing.T) {
+	conf := gokurou.NewConfiguration(1, 1)
+	conf.Options[includePatternsConfKey] = []string{"("}
+
+	if _, err := newScope(conf); err == nil {
+		t.Errorf("newScope() = nil, want = error")
+	}
+}
@@ -4,8 +4,6 @@ import (
 	"context"
 	"time"
 
-	"github.com/murakmii/gokurou/pkg/gokurou/www"
-
 	"github.com/google/uuid"
 )
 
@@ -16,6 +14,11 @@ type Worker struct {
 const (
 	// ArtifactGatherer, URLFrontier(Pop+Push), Crawlerからの計4つの結果を待つ
 	expectedResults = 4
+
+	// IPアドレスでロックできなかったURLを、再びPopされるまでに空ける時間と、ロックを諦めるまでにURLの集合に戻す回数
+	// ロックは少なくとも1分間保持されるため、それに合わせて待つ
+	lockDeferralDelay = 60 * time.Second
+	maxLockDeferrals  = 100
 )
 
 func NewWorker() *Worker {
@@ -40,14 +43,15 @@ func (w *Worker) Start(ctx context.Context, conf *Configuration) {
 		return
 	}
 
-	ctx, cancel := WorkerContext(ctx, gwn)
+	// Crawler等からも他のworkerと協調できるよう、ContextからCoordinatorを参照できるようにする
+	ctx, cancel := WorkerContext(ContextWithCoordinator(ctx, coordinator), gwn)
 	logger = LoggerFromContext(ctx)
 	logger.Info("worker is started")
 
 	// 各種SubSystemを生成し、全ての結果がChannelに書き込まれるまでブロックする
-	frontier, popCh, pushCh := w.startURLFrontier(ctx, conf, coordinator)
+	frontier, popCh, pushCh, retryCh := w.startURLFrontier(ctx, conf, coordinator)
 	gatherer, acCh := w.startArtifactGatherer(ctx, conf)
-	crawler := w.startCrawler(ctx, conf, popCh, NewOutputPipeline(acCh, pushCh))
+	crawler := w.startCrawler(ctx, conf, popCh, NewOutputPipeline(acCh, pushCh, retryCh))
 
 	for received := 0; received < expectedResults; received++ {
 		if err := <-w.resultCh; err != nil {
@@ -103,28 +107,29 @@ func (w *Worker) startArtifactGatherer(ctx context.Context, conf *Configuration)
 }
 
 // URLFrontire用goroutineを起動する
-func (w *Worker) startURLFrontier(ctx context.Context, conf *Configuration, coordinator Coordinator) (URLFrontier, <-chan *www.SanitizedURL, chan<- *SpawnedURL) {
+func (w *Worker) startURLFrontier(ctx context.Context, conf *Configuration, coordinator Coordinator) (URLFrontier, <-chan *PoppedURL, chan<- *SpawnedURL, chan<- *RetryURL) {
 	ctx = SubSystemContext(ctx, "url-frontier")
-	popCh := make(chan *www.SanitizedURL, 1)
+	popCh := make(chan *PoppedURL, 1)
 	pushCh := make(chan *SpawnedURL, 50)
+	retryCh := make(chan *RetryURL, 10)
 
 	urlFrontier, err := conf.URLFrontierProvider(ctx, conf)
 	if err != nil {
 		w.resultCh <- err
-		return nil, popCh, pushCh
+		return nil, popCh, pushCh, retryCh
 	}
 
 	// URLFrontierのPopを回し続けるgoroutineを立ち上げる
 	go func() {
 		idle := 0
 		for {
-			url, err := urlFrontier.Pop(ctx)
+			popped, err := urlFrontier.Pop(ctx)
 			if err != nil {
 				w.resultCh <- err
 				return
 			}
 
-			if url == nil {
+			if popped == nil {
 				// Pop出来ないならしばらく待つ
 				idle++
 				select {
@@ -135,19 +140,33 @@ func (w *Worker) startURLFrontier(ctx context.Context, conf *Configuration, coor
 				}
 			} else {
 				// Pop出来た場合はIPアドレスレベルでロックできるか確認し、それでも問題なければChannelに書き込む(最終的にCrawlerに渡される)
-				locked, err := coordinator.LockByIPAddrOf(url.Host())
+				locked, err := coordinator.LockByIPAddrOf(popped.URL.Hostname())
 				if err != nil {
 					w.resultCh <- err
 					return
 				}
 
+				// ロックできなかったURLは、時間を空けて再びPopされるようURLの集合に戻す
+				// 何度戻してもロックできない場合(名前解決できない場合等)は、諦めたことの記録をCrawlerに任せる
 				if !locked {
 					idle++
-					continue // TODO: IPアドレスでロックできなかったURLはとりあえず捨てている
+					if popped.Deferred < maxLockDeferrals {
+						deferred := *popped
+						deferred.Deferred++
+						select {
+						case retryCh <- &RetryURL{Popped: &deferred, Delay: lockDeferralDelay}:
+							continue
+						case <-ctx.Done():
+							w.resultCh <- nil
+							return
+						}
+					}
+
+					popped.LockFailed = true
 				}
 
 				select {
-				case popCh <- url:
+				case popCh <- popped:
 					TracerFromContext(ctx).TracePopIdle(ctx, idle)
 					idle = 0
 				case <-ctx.Done():
@@ -158,7 +177,7 @@ func (w *Worker) startURLFrontier(ctx context.Context, conf *Configuration, coor
 		}
 	}()
 
-	// URLFrontierのPushを回し続けるgoroutineを立ち上げる
+	// URLFrontierのPush(再試行を含む)を回し続けるgoroutineを立ち上げる
 	go func() {
 		for {
 			select {
@@ -168,6 +187,11 @@ func (w *Worker) startURLFrontier(ctx context.Context, conf *Configuration, coor
 					w.resultCh <- err
 					return
 				}
+			case retry := <-retryCh:
+				if err := urlFrontier.Retry(ctx, retry); err != nil {
+					w.resultCh <- err
+					return
+				}
 			case <-ctx.Done():
 				w.resultCh <- nil
 				return
@@ -175,11 +199,11 @@ func (w *Worker) startURLFrontier(ctx context.Context, conf *Configuration, coor
 		}
 	}()
 
-	return urlFrontier, popCh, pushCh
+	return urlFrontier, popCh, pushCh, retryCh
 }
 
 // Crawler用goroutineを起動する
-func (w *Worker) startCrawler(ctx context.Context, conf *Configuration, popCh <-chan *www.SanitizedURL, out OutputPipeline) Crawler {
+func (w *Worker) startCrawler(ctx context.Context, conf *Configuration, popCh <-chan *PoppedURL, out OutputPipeline) Crawler {
 	ctx = SubSystemContext(ctx, "crawler")
 	crawler, err := conf.CrawlerProvider(ctx, conf)
 	if err != nil {
@@ -192,7 +216,7 @@ func (w *Worker) startCrawler(ctx context.Context, conf *Configuration, popCh <-
 		for {
 			started := time.Now()
 			select {
-			case url := <-popCh:
+			case popped := <-popCh:
 				TracerFromContext(ctx).TracePop(ctx, time.Since(started).Seconds())
 				TracerFromContext(ctx).TraceStartedCrawl(ctx)
 
@@ -201,7 +225,7 @@ func (w *Worker) startCrawler(ctx context.Context, conf *Configuration, popCh <-
 				logger := LoggerFromContext(ctx)
 				ctx = ContextWithLogger(ctx, logger.WithField("id", id.String()))
 
-				if err := crawler.Crawl(ctx, url, out); err != nil {
+				if err := crawler.Crawl(ctx, popped, out); err != nil {
 					w.resultCh <- err
 					return
 				}
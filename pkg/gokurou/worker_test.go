@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -30,6 +31,14 @@ func (s *mockCoordinator) LockByIPAddrOf(host string) (bool, error) {
 	return !strings.HasSuffix(host, ".org"), nil
 }
 
+func (s *mockCoordinator) ExtendLockByIPAddrOf(_ string, _ time.Duration) error {
+	return nil
+}
+
+func (s *mockCoordinator) FindDuplicateContent(_ string, _ string, _ uint64) (*DuplicateContent, error) {
+	return nil, nil
+}
+
 func (s *mockCoordinator) Finish() error { return nil }
 func (s *mockCoordinator) Reset() error  { return nil }
 
@@ -74,16 +83,21 @@ func (f *mockURLFrontier) Push(ctx context.Context, spawned *SpawnedURL) error {
 	return nil
 }
 
-func (f *mockURLFrontier) Pop(ctx context.Context) (*www.SanitizedURL, error) {
+func (f *mockURLFrontier) Pop(ctx context.Context) (*PoppedURL, error) {
 	if len(f.queue) == 0 {
 		return nil, nil
 	} else {
 		url := f.queue[0]
 		f.queue = f.queue[1:]
-		return url, nil
+		return &PoppedURL{URL: url}, nil
 	}
 }
 
+func (f *mockURLFrontier) Retry(ctx context.Context, retry *RetryURL) error {
+	f.queue = append(f.queue, retry.Popped.URL)
+	return nil
+}
+
 func (f *mockURLFrontier) Seeding(_ context.Context, url []string) error { return nil }
 func (f *mockURLFrontier) Finish() error                                 { return nil }
 func (f *mockURLFrontier) Reset() error                                  { return nil }
@@ -95,7 +109,8 @@ func buildMockCrawler(_ context.Context, _ *Configuration) (Crawler, error) {
 	return &mockCrawler{}, nil
 }
 
-func (c *mockCrawler) Crawl(ctx context.Context, url *www.SanitizedURL, out OutputPipeline) error {
+func (c *mockCrawler) Crawl(ctx context.Context, popped *PoppedURL, out OutputPipeline) error {
+	url := popped.URL
 	parts := strings.Split(url.Host(), ".")
 	no, err := strconv.Atoi(parts[0])
 	if err != nil {
@@ -159,3 +174,153 @@ func TestWorker_Start(t *testing.T) {
 		}
 	}
 }
+
+// 呼び出し回数に応じてロックを獲得できるCoordinatorのモック
+// ホスト毎にlockEvery回に1回だけロックを獲得できる(ロックが切れるまでの間は獲得できないことを表す)。0ならロックを獲得できない
+type countingCoordinator struct {
+	mockCoordinator
+	mu        sync.Mutex
+	calls     map[string]int
+	lockEvery int
+}
+
+func (c *countingCoordinator) LockByIPAddrOf(host string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.calls[host]++
+	return c.lockEvery > 0 && c.calls[host]%c.lockEvery == 0, nil
+}
+
+// PoppedURLをそのまま保持し、戻されたURLを記録するURLFrontierのモック
+// 戻されたURLはすぐにPopできるようにし、Workerが空のPopで待たないようにする
+type queueURLFrontier struct {
+	mockURLFrontier
+	mu      sync.Mutex
+	queue   chan *PoppedURL
+	retried []*RetryURL
+}
+
+func buildQueueURLFrontier(popped ...*PoppedURL) *queueURLFrontier {
+	f := &queueURLFrontier{queue: make(chan *PoppedURL, len(popped)+1)}
+	for _, p := range popped {
+		f.queue <- p
+	}
+	return f
+}
+
+func (f *queueURLFrontier) Pop(_ context.Context) (*PoppedURL, error) {
+	select {
+	case popped := <-f.queue:
+		return popped, nil
+	case <-time.After(10 * time.Millisecond):
+		return nil, nil
+	}
+}
+
+func (f *queueURLFrontier) Retry(_ context.Context, retry *RetryURL) error {
+	f.mu.Lock()
+	f.retried = append(f.retried, retry)
+	f.mu.Unlock()
+
+	f.queue <- retry.Popped
+	return nil
+}
+
+// 与えられたURLを記録するだけのCrawlerのモック
+type recordingCrawler struct {
+	mu      sync.Mutex
+	crawled []*PoppedURL
+}
+
+func (c *recordingCrawler) Crawl(_ context.Context, popped *PoppedURL, _ OutputPipeline) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.crawled = append(c.crawled, popped)
+	return nil
+}
+
+func (c *recordingCrawler) Finish() error { return nil }
+
+func startWorkerWithMocks(coordinator Coordinator, frontier URLFrontier, crawler Crawler) {
+	conf := buildConfiguration()
+	conf.CoordinatorProvider = func(_ *Configuration) (Coordinator, error) { return coordinator, nil }
+	conf.URLFrontierProvider = func(_ context.Context, _ *Configuration) (URLFrontier, error) { return frontier, nil }
+	conf.CrawlerProvider = func(_ context.Context, _ *Configuration) (Crawler, error) { return crawler, nil }
+
+	ctx, cancel := context.WithTimeout(MustRootContext(conf), 500*time.Millisecond)
+	defer cancel()
+
+	NewWorker().Start(ctx, conf)
+}
+
+func TestWorker_Start_LockFailure(t *testing.T) {
+	t.Run("再試行するURLをIPアドレスでロックできない場合、時間を空けてURLの集合に戻す", func(t *testing.T) {
+		url, _ := www.SanitizedURLFromString("http://example.com/")
+		coordinator := &countingCoordinator{calls: make(map[string]int), lockEvery: 3}
+		frontier := buildQueueURLFrontier(&PoppedURL{URL: url, Attempt: 1})
+		crawler := &recordingCrawler{}
+
+		startWorkerWithMocks(coordinator, frontier, crawler)
+
+		if len(frontier.retried) != 2 {
+			t.Fatalf("Start() retried %d times, want = 2", len(frontier.retried))
+		}
+
+		for _, retried := range frontier.retried {
+			if retried.Delay != lockDeferralDelay || retried.Popped.Attempt != 1 {
+				t.Errorf("Start() retried %+v, want delay = %s, attempt = 1", retried, lockDeferralDelay)
+			}
+		}
+
+		if len(crawler.crawled) != 1 || crawler.crawled[0].Attempt != 1 || crawler.crawled[0].Deferred != 2 || crawler.crawled[0].LockFailed {
+			t.Errorf("Start() passes %+v to crawler", crawler.crawled)
+		}
+	})
+
+	t.Run("何度戻してもロックできない場合、諦めたことの記録をCrawlerに任せる", func(t *testing.T) {
+		url, _ := www.SanitizedURLFromString("http://example.com/")
+		coordinator := &countingCoordinator{calls: make(map[string]int)}
+		frontier := buildQueueURLFrontier(&PoppedURL{URL: url, Attempt: 1})
+		crawler := &recordingCrawler{}
+
+		startWorkerWithMocks(coordinator, frontier, crawler)
+
+		if len(frontier.retried) != maxLockDeferrals {
+			t.Errorf("Start() retried %d times, want = %d", len(frontier.retried), maxLockDeferrals)
+		}
+
+		if len(crawler.crawled) != 1 || !crawler.crawled[0].LockFailed || crawler.crawled[0].Deferred != maxLockDeferrals {
+			t.Errorf("Start() passes %+v to crawler", crawler.crawled)
+		}
+	})
+
+	t.Run("同じサイトのURLを続けてPopした場合、ロックできなかったURLも捨てずに全てクロールする", func(t *testing.T) {
+		popped := make([]*PoppedURL, 5)
+		for i := range popped {
+			url, _ := www.SanitizedURLFromString(fmt.Sprintf("http://example.com/%d", i))
+			popped[i] = &PoppedURL{URL: url}
+		}
+
+		coordinator := &countingCoordinator{calls: make(map[string]int), lockEvery: 3}
+		frontier := buildQueueURLFrontier(popped...)
+		crawler := &recordingCrawler{}
+
+		startWorkerWithMocks(coordinator, frontier, crawler)
+
+		crawled := make(map[string]int)
+		for _, p := range crawler.crawled {
+			if p.LockFailed || p.Attempt != 0 {
+				t.Errorf("Start() passes %+v to crawler", p)
+			}
+			crawled[p.URL.String()]++
+		}
+
+		for _, p := range popped {
+			if crawled[p.URL.String()] != 1 {
+				t.Errorf("Start() crawled %s %d times, want = 1", p.URL, crawled[p.URL.String()])
+			}
+		}
+	})
+}
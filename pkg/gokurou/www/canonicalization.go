@@ -0,0 +1,220 @@
+package www
+
+import (
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// 末尾のスラッシュの扱い
+type TrailingSlashPolicy string
+
+const (
+	KeepTrailingSlash   TrailingSlashPolicy = "keep"   // そのままにする
+	AddTrailingSlash    TrailingSlashPolicy = "add"    // 拡張子を持たないパスには付与する
+	RemoveTrailingSlash TrailingSlashPolicy = "remove" // ルート以外のパスからは取り除く
+)
+
+// SanitizedURLを生成する際に適用する正規化のルール
+// 同じページを指すURLが同じ文字列になるよう正規化することで、URL単位やホスト単位の重複排除を正しく行えるようにする
+type CanonicalRules struct {
+	LowercaseHost      bool                // ホスト部を小文字にする
+	StripWWW           bool                // ホスト部先頭の"www."を取り除く
+	RemoveDefaultPort  bool                // スキームのデフォルトポート(httpの80, httpsの443)の指定を取り除く
+	RemoveFragment     bool                // フラグメントを取り除く
+	CollapseSlashes    bool                // パス中の連続するスラッシュを1つにまとめる
+	ResolveDotSegments bool                // パス中の"."や".."を解決する
+	TrailingSlash      TrailingSlashPolicy // パス末尾のスラッシュの扱い
+	SortQuery          bool                // クエリパラメータをキーでソートする
+	StripParams        []string            // 取り除くクエリパラメータ(とパスパラメータ)の名前。末尾が'*'なら前方一致とし、大文字小文字は区別しない
+}
+
+// デフォルトの正規化のルールを返す
+func DefaultCanonicalRules() *CanonicalRules {
+	return &CanonicalRules{
+		LowercaseHost:      true,
+		StripWWW:           false,
+		RemoveDefaultPort:  true,
+		RemoveFragment:     true,
+		CollapseSlashes:    true,
+		ResolveDotSegments: true,
+		TrailingSlash:      KeepTrailingSlash,
+		SortQuery:          true,
+		StripParams: []string{
+			// トラッキング用のパラメータ
+			"utm_*", "fbclid", "gclid", "dclid", "yclid", "msclkid", "mc_cid", "mc_eid", "_ga", "_gl",
+			// セッションID
+			"jsessionid", "phpsessid", "aspsessionid*", "sessionid", "cfid", "cftoken",
+		},
+	}
+}
+
+// ホスト部(ポートを含まない)を正規化する
+func (rules *CanonicalRules) canonicalHost(host string) string {
+	if rules.LowercaseHost {
+		host = strings.ToLower(host)
+	}
+
+	if rules.StripWWW && strings.HasPrefix(strings.ToLower(host), "www.") && strings.Count(host, ".") >= 2 {
+		host = host[4:]
+	}
+
+	return host
+}
+
+// ポートがスキームのデフォルトポートであり、取り除くべきかどうかを返す
+func (rules *CanonicalRules) removesPort(scheme, port string) bool {
+	return rules.RemoveDefaultPort && ((scheme == "http" && port == "80") || (scheme == "https" && port == "443"))
+}
+
+// パス部を正規化する
+func (rules *CanonicalRules) canonicalPath(p string) string {
+	if len(p) == 0 {
+		return p
+	}
+
+	if rules.CollapseSlashes {
+		for strings.Contains(p, "//") {
+			p = strings.Replace(p, "//", "/", -1)
+		}
+	}
+
+	if rules.ResolveDotSegments {
+		p = removeDotSegments(p)
+	}
+
+	if len(rules.StripParams) > 0 && strings.Contains(p, ";") {
+		p = rules.stripPathParams(p)
+	}
+
+	switch rules.TrailingSlash {
+	case AddTrailingSlash:
+		if !strings.HasSuffix(p, "/") && !strings.Contains(path.Base(p), ".") {
+			p += "/"
+		}
+
+	case RemoveTrailingSlash:
+		if p != "/" {
+			p = strings.TrimRight(p, "/")
+			if len(p) == 0 {
+				p = "/"
+			}
+		}
+	}
+
+	return p
+}
+
+// クエリ部を正規化する
+func (rules *CanonicalRules) canonicalQuery(rawQuery string) string {
+	type param struct {
+		key   string
+		value string
+	}
+
+	params := make([]param, 0, 10)
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if len(pair) == 0 {
+			continue
+		}
+
+		kv := strings.SplitN(pair, "=", 2)
+		key, err := url.QueryUnescape(kv[0])
+		if err != nil || rules.stripsParam(key) {
+			continue
+		}
+
+		var value string
+		if len(kv) == 2 {
+			if value, err = url.QueryUnescape(kv[1]); err != nil {
+				continue
+			}
+		}
+
+		params = append(params, param{key: key, value: value})
+	}
+
+	if rules.SortQuery {
+		sort.SliceStable(params, func(i, j int) bool { return params[i].key < params[j].key })
+	}
+
+	encoded := make([]string, len(params))
+	for i, p := range params {
+		encoded[i] = url.QueryEscape(p.key) + "=" + url.QueryEscape(p.value)
+	}
+
+	return strings.Join(encoded, "&")
+}
+
+// 取り除くべきパラメータかどうかを返す
+func (rules *CanonicalRules) stripsParam(key string) bool {
+	key = strings.ToLower(key)
+	for _, ptn := range rules.StripParams {
+		ptn = strings.ToLower(ptn)
+		if strings.HasSuffix(ptn, "*") {
+			if strings.HasPrefix(key, ptn[:len(ptn)-1]) {
+				return true
+			}
+		} else if key == ptn {
+			return true
+		}
+	}
+
+	return false
+}
+
+// "/path;jsessionid=xxx"のようなパスパラメータのうち、取り除くべきものを取り除く
+func (rules *CanonicalRules) stripPathParams(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		params := strings.Split(segment, ";")
+		if len(params) == 1 {
+			continue
+		}
+
+		kept := params[:1]
+		for _, param := range params[1:] {
+			if !rules.stripsParam(strings.SplitN(param, "=", 2)[0]) {
+				kept = append(kept, param)
+			}
+		}
+		segments[i] = strings.Join(kept, ";")
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// RFC 3986 5.2.4 に従ってパス中の"."や".."を解決する
+func removeDotSegments(p string) string {
+	if !strings.Contains(p, ".") {
+		return p
+	}
+
+	segments := strings.Split(p, "/")
+	resolved := make([]string, 0, len(segments))
+
+	for i, segment := range segments {
+		last := i == len(segments)-1
+
+		switch segment {
+		case ".":
+			if last {
+				resolved = append(resolved, "")
+			}
+
+		case "..":
+			if len(resolved) > 1 {
+				resolved = resolved[:len(resolved)-1]
+			}
+			if last {
+				resolved = append(resolved, "")
+			}
+
+		default:
+			resolved = append(resolved, segment)
+		}
+	}
+
+	return strings.Join(resolved, "/")
+}
@@ -0,0 +1,94 @@
+package www
+
+import "testing"
+
+func TestSanitizedURLFromString_Canonicalization(t *testing.T) {
+	t.Run("デフォルトのルールの場合", func(t *testing.T) {
+		tests := []struct {
+			in  string
+			out string
+		}{
+			{in: "http://WWW.Example.COM/Path", out: "http://www.example.com/Path"},
+			{in: "http://example.com:80/", out: "http://example.com/"},
+			{in: "https://example.com:443/", out: "https://example.com/"},
+			{in: "http://example.com/page#section", out: "http://example.com/page"},
+			{in: "http://example.com//a///b", out: "http://example.com/a/b"},
+			{in: "http://example.com/a/./b/../c/", out: "http://example.com/a/c/"},
+			{in: "http://example.com/../a/..", out: "http://example.com/"},
+			{in: "http://example.com/?b=2&a=1&a=0", out: "http://example.com/?a=1&a=0&b=2"},
+			{in: "http://example.com/?utm_source=x&id=1&fbclid=y&UTM_MEDIUM=z", out: "http://example.com/?id=1"},
+			{in: "http://example.com/a;jsessionid=abc/b;v=1?PHPSESSID=xyz", out: "http://example.com/a/b;v=1"},
+		}
+
+		for _, tt := range tests {
+			sanitized, err := SanitizedURLFromString(tt.in)
+			if err != nil {
+				t.Errorf("SanitizedURLFromString(%s) = %v, want = no error", tt.in, err)
+				continue
+			}
+
+			if sanitized.String() != tt.out {
+				t.Errorf("SanitizedURLFromString(%s) = %s, want = %s", tt.in, sanitized.String(), tt.out)
+			}
+		}
+	})
+
+	t.Run("ルールを変更した場合", func(t *testing.T) {
+		sanitizer := NewSanitizer(&CanonicalRules{
+			LowercaseHost: true,
+			StripWWW:      true,
+			TrailingSlash: AddTrailingSlash,
+			StripParams:   []string{"ref"},
+		}, nil)
+
+		tests := []struct {
+			in  string
+			out string
+		}{
+			{in: "http://www.example.com/a", out: "http://example.com/a/"},
+			{in: "http://www.com/a.html", out: "http://www.com/a.html"},
+			{in: "http://example.com/a//b/../c#top", out: "http://example.com/a//b/../c/#top"},
+			{in: "http://example.com/?b=2&ref=x&a=1", out: "http://example.com/?b=2&a=1"},
+		}
+
+		for _, tt := range tests {
+			sanitized, err := sanitizer.FromString(tt.in)
+			if err != nil {
+				t.Errorf("SanitizedURLFromString(%s) = %v, want = no error", tt.in, err)
+				continue
+			}
+
+			if sanitized.String() != tt.out {
+				t.Errorf("SanitizedURLFromString(%s) = %s, want = %s", tt.in, sanitized.String(), tt.out)
+			}
+		}
+
+		// Joinで生成したURLにも同じルールを適用する
+		base, _ := sanitizer.FromString("http://www.example.com/a/")
+		joined, err := base.Join("http://www.example.org/b?ref=x")
+		if err != nil || joined.String() != "http://example.org/b/" {
+			t.Errorf("Join() = %v, %v, want = http://example.org/b/", joined, err)
+		}
+	})
+}
+
+func TestRemoveDotSegments(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "/a/b/c", want: "/a/b/c"},
+		{in: "/a/b/../c", want: "/a/c"},
+		{in: "/a/./b/", want: "/a/b/"},
+		{in: "/a/b/..", want: "/a/"},
+		{in: "/..", want: "/"},
+		{in: "/a/.hidden/file.txt", want: "/a/.hidden/file.txt"},
+	}
+
+	for _, tt := range tests {
+		got := removeDotSegments(tt.in)
+		if got != tt.want {
+			t.Errorf("removeDotSegments(%s) = %s, want = %s", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package www
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// 本文とみなすブロックの最小文字数
+	minMainTextBlockRunes = 10
+
+	// 本文とみなすブロックのリンク密度(リンク中の文字数 / 全文字数)の上限
+	maxMainTextLinkDensity = 0.33
+)
+
+var (
+	// テキストをブロックに区切るタグ
+	blockTags = map[string]struct{}{
+		"address": {}, "article": {}, "blockquote": {}, "body": {}, "br": {}, "dd": {}, "div": {}, "dl": {},
+		"dt": {}, "figcaption": {}, "h1": {}, "h2": {}, "h3": {}, "h4": {}, "h5": {}, "h6": {}, "hr": {},
+		"li": {}, "main": {}, "ol": {}, "p": {}, "pre": {}, "section": {}, "table": {}, "td": {}, "th": {},
+		"tr": {}, "ul": {},
+	}
+
+	// 終了タグを持たないブロックのタグ
+	voidBlockTags = map[string]struct{}{"br": {}, "hr": {}}
+
+	// 中身を本文として扱わないタグ
+	boilerplateTags = map[string]struct{}{
+		"aside": {}, "button": {}, "footer": {}, "form": {}, "head": {}, "header": {}, "iframe": {},
+		"nav": {}, "noscript": {}, "script": {}, "select": {}, "style": {}, "svg": {}, "template": {},
+	}
+)
+
+// HTML中のテキストをブロック単位で集計し、リンク密度と文字数から本文を抽出する型
+type textExtractor struct {
+	blocks    []*textBlock
+	current   *textBlock
+	open      []string // 開いているブロックのタグ名
+	skips     []int    // 閉じていない、中身を本文として扱わないタグ毎の、それを開いた時点で開いていたブロックの数
+	linkDepth int
+}
+
+// テキストのまとまりを表す型
+type textBlock struct {
+	text      strings.Builder
+	runes     int
+	linkRunes int
+}
+
+func newTextExtractor() *textExtractor {
+	return &textExtractor{
+		blocks:  make([]*textBlock, 0, 50),
+		current: &textBlock{},
+	}
+}
+
+// 開始タグを受け取る
+func (e *textExtractor) startTag(name string) {
+	if _, ok := boilerplateTags[name]; ok {
+		e.skips = append(e.skips, len(e.open))
+		return
+	}
+
+	if name == "a" {
+		e.linkDepth++
+	}
+
+	if _, ok := blockTags[name]; ok {
+		if _, void := voidBlockTags[name]; !void {
+			e.open = append(e.open, name)
+		}
+		e.flush()
+	}
+}
+
+// 終了タグを受け取る
+func (e *textExtractor) endTag(name string) {
+	if _, ok := boilerplateTags[name]; ok {
+		if len(e.skips) > 0 {
+			e.skips = e.skips[:len(e.skips)-1]
+		}
+		return
+	}
+
+	if name == "a" && e.linkDepth > 0 {
+		e.linkDepth--
+	}
+
+	if _, ok := blockTags[name]; ok {
+		e.closeBlock(name)
+		e.flush()
+	}
+}
+
+// ブロックを閉じる
+// 閉じられていない<nav>等があっても、それを囲むブロックや<body>が閉じられた時点で閉じられたものとする
+func (e *textExtractor) closeBlock(name string) {
+	if name == "body" {
+		e.open = e.open[:0]
+		e.skips = e.skips[:0]
+		return
+	}
+
+	for i := len(e.open) - 1; i >= 0; i-- {
+		if e.open[i] == name {
+			e.open = e.open[:i]
+			break
+		}
+	}
+
+	for len(e.skips) > 0 && e.skips[len(e.skips)-1] > len(e.open) {
+		e.skips = e.skips[:len(e.skips)-1]
+	}
+}
+
+// テキストを受け取る
+func (e *textExtractor) text(s string) {
+	if len(e.skips) > 0 {
+		return
+	}
+
+	normalized := strings.Join(strings.Fields(s), " ")
+	if len(normalized) == 0 {
+		return
+	}
+
+	if e.current.text.Len() > 0 {
+		e.current.text.WriteByte(' ')
+	}
+	e.current.text.WriteString(normalized)
+
+	n := utf8.RuneCountInString(normalized)
+	e.current.runes += n
+	if e.linkDepth > 0 {
+		e.current.linkRunes += n
+	}
+}
+
+// 現在のブロックを確定させ、次のブロックの集計を始める
+func (e *textExtractor) flush() {
+	if e.current.runes > 0 {
+		e.blocks = append(e.blocks, e.current)
+	}
+	e.current = &textBlock{}
+}
+
+// 本文と判定したブロックを改行区切りで連結して返す
+func (e *textExtractor) mainText() string {
+	e.flush()
+
+	kept := make([]bool, len(e.blocks))
+	for i, block := range e.blocks {
+		kept[i] = block.runes >= minMainTextBlockRunes && block.linkDensity() <= maxMainTextLinkDensity
+	}
+
+	// 短くてもリンクを含まず、本文に挟まれているブロックは本文の一部とみなす
+	for i := 1; i < len(e.blocks)-1; i++ {
+		if !kept[i] && e.blocks[i].linkRunes == 0 && kept[i-1] && kept[i+1] {
+			kept[i] = true
+		}
+	}
+
+	texts := make([]string, 0, len(e.blocks))
+	for i, block := range e.blocks {
+		if kept[i] {
+			texts = append(texts, block.text.String())
+		}
+	}
+
+	return strings.Join(texts, "\n")
+}
+
+func (b *textBlock) linkDensity() float64 {
+	return float64(b.linkRunes) / float64(b.runes)
+}
+
+// テキスト中の単語数を数える
+// 日本語や中国語のように単語を空白で区切らない文字は、1文字を1単語として数える
+func countWords(s string) int {
+	count := 0
+	inWord := false
+
+	for _, r := range s {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Thai):
+			count++
+			inWord = false
+
+		case unicode.IsLetter(r) || unicode.IsNumber(r):
+			if !inWord {
+				count++
+				inWord = true
+			}
+
+		case r == '\'' || r == '-':
+			// "don't" や "e-mail" のような単語の途中の記号は区切りとみなさない
+
+		default:
+			inWord = false
+		}
+	}
+
+	return count
+}
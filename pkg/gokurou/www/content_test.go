@@ -0,0 +1,95 @@
+package www
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseHTML_MainText(t *testing.T) {
+	baseURL, err := SanitizedURLFromString("http://www.example.com/")
+	if err != nil {
+		panic(err)
+	}
+
+	page, err := ParseHTML(openTestData("testdata/article.html"), baseURL)
+	if err != nil {
+		t.Errorf("ParseHTML(testdata/article.html) = %v, want = no error", err)
+		return
+	}
+
+	want := "This is the first paragraph of the article, and it is long enough.\n短い\n二つ目の段落です。 詳細 はこちらをご覧ください。"
+	if page.MainText() != want {
+		t.Errorf("MainText() = %q, want = %q", page.MainText(), want)
+	}
+
+	if page.WordCount() != 36 {
+		t.Errorf("WordCount() = %d, want = 36", page.WordCount())
+	}
+}
+
+func TestParseHTML_MainText_UnclosedBoilerplate(t *testing.T) {
+	baseURL, err := SanitizedURLFromString("http://www.example.com/")
+	if err != nil {
+		panic(err)
+	}
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "閉じられていない<nav>を囲むブロックが閉じられた場合、それ以降のテキストを本文として扱う",
+			in:   "<body><div><nav><ul><li><a href='/'>Top</a></div><p>This paragraph comes after the navigation.</p></body>",
+			want: "This paragraph comes after the navigation.",
+		},
+		{
+			name: "閉じられていない<header>が<body>直下にある場合、</body>で閉じられたものとする",
+			in:   "<body><header><a href='/'>Top</a><p>This paragraph is inside the header.</p></body><p>This paragraph comes after the body.</p>",
+			want: "This paragraph comes after the body.",
+		},
+		{
+			name: "閉じられた<nav>の中のブロックは本文として扱わない",
+			in:   "<body><nav><div>This block is inside the navigation.</div></nav><p>This paragraph comes after the navigation.</p></body>",
+			want: "This paragraph comes after the navigation.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := ParseHTML(strings.NewReader(tt.in), baseURL)
+			if err != nil {
+				t.Errorf("ParseHTML() = %v, want = no error", err)
+				return
+			}
+
+			if page.MainText() != tt.want {
+				t.Errorf("MainText() = %q, want = %q", page.MainText(), tt.want)
+			}
+
+			if page.WordCount() != countWords(tt.want) {
+				t.Errorf("WordCount() = %d, want = %d", page.WordCount(), countWords(tt.want))
+			}
+		})
+	}
+}
+
+func TestCountWords(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{in: "", want: 0},
+		{in: "Hello, world!", want: 2},
+		{in: "don't use e-mail", want: 3},
+		{in: "日本語テキスト", want: 7},
+		{in: "Go言語 1.13", want: 5},
+	}
+
+	for _, tt := range tests {
+		got := countWords(tt.in)
+		if got != tt.want {
+			t.Errorf("countWords(%s) = %d, want = %d", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package www
+
+import (
+	"net"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Public Suffix Listに基づき、ホスト名から登録可能なドメイン(eTLD+1)を返す
+// "foo.example.co.jp"なら"example.co.jp"となる。IPアドレスや、ホスト名自体がパブリックサフィックスである場合はそのまま返す
+func RegistrableDomain(hostname string) string {
+	hostname = strings.TrimSuffix(strings.ToLower(hostname), ".")
+	if net.ParseIP(hostname) != nil {
+		return hostname
+	}
+
+	domain, err := publicsuffix.EffectiveTLDPlusOne(hostname)
+	if err != nil {
+		return hostname
+	}
+
+	return domain
+}
+
+// Public Suffix Listに基づき、ホスト名のパブリックサフィックス("com"や"co.jp", "github.io"など)を返す
+func PublicSuffix(hostname string) string {
+	hostname = strings.TrimSuffix(strings.ToLower(hostname), ".")
+	if net.ParseIP(hostname) != nil {
+		return ""
+	}
+
+	suffix, _ := publicsuffix.PublicSuffix(hostname)
+	return suffix
+}
+
+// ホスト部が表すドメインのうち、登録可能なドメイン(eTLD+1)を返す
+func (sanitized *SanitizedURL) RegistrableDomain() string {
+	return RegistrableDomain(sanitized.Hostname())
+}
+
+// ホスト部が表すドメインのパブリックサフィックスを返す
+func (sanitized *SanitizedURL) PublicSuffix() string {
+	return PublicSuffix(sanitized.Hostname())
+}
@@ -0,0 +1,45 @@
+package www
+
+import "testing"
+
+func TestRegistrableDomain(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "example.com", want: "example.com"},
+		{in: "www.example.com", want: "example.com"},
+		{in: "foo.example.co.jp", want: "example.co.jp"},
+		{in: "example.com.au", want: "example.com.au"},
+		{in: "murakmii.github.io", want: "murakmii.github.io"},
+		{in: "co.jp", want: "co.jp"},
+		{in: "localhost", want: "localhost"},
+		{in: "127.0.0.1", want: "127.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		got := RegistrableDomain(tt.in)
+		if got != tt.want {
+			t.Errorf("RegistrableDomain(%s) = %s, want = %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPublicSuffix(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "example.com", want: "com"},
+		{in: "foo.example.co.jp", want: "co.jp"},
+		{in: "murakmii.github.io", want: "github.io"},
+		{in: "127.0.0.1", want: ""},
+	}
+
+	for _, tt := range tests {
+		got := PublicSuffix(tt.in)
+		if got != tt.want {
+			t.Errorf("PublicSuffix(%s) = %s, want = %s", tt.in, got, tt.want)
+		}
+	}
+}
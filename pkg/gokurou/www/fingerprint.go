@@ -0,0 +1,78 @@
+package www
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"hash/fnv"
+	"strings"
+	"unicode"
+)
+
+// SimHashの特徴量として用いる文字n-gramの長さ
+const simHashShingleSize = 3
+
+// テキストの内容を表すハッシュ値を返す。空白の違いや大文字小文字の違いは無視する
+func ContentHash(text string) string {
+	sum := sha1.Sum([]byte(normalizeForFingerprint(text)))
+	return hex.EncodeToString(sum[:])
+}
+
+// テキストの内容から64bitのSimHashを計算する
+// 内容が似ているテキスト同士ほど、ハミング距離が小さい値になる
+func SimHash(text string) uint64 {
+	runes := []rune(normalizeForFingerprint(text))
+	if len(runes) == 0 {
+		return 0
+	}
+
+	var weights [64]int
+	for i := 0; i+simHashShingleSize <= len(runes) || i == 0; i++ {
+		end := i + simHashShingleSize
+		if end > len(runes) {
+			end = len(runes)
+		}
+
+		// hash.Hash64のWriteは絶対にエラーを返さない
+		hash := fnv.New64a()
+		_, _ = hash.Write([]byte(string(runes[i:end])))
+		sum := hash.Sum64()
+
+		for bit := uint(0); bit < 64; bit++ {
+			if sum&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	var simHash uint64
+	for bit := uint(0); bit < 64; bit++ {
+		if weights[bit] > 0 {
+			simHash |= 1 << bit
+		}
+	}
+
+	return simHash
+}
+
+// 2つのSimHashのハミング距離を返す
+func HammingDistance(a, b uint64) int {
+	distance := 0
+	for x := a ^ b; x != 0; x &= x - 1 {
+		distance++
+	}
+	return distance
+}
+
+// フィンガープリントの計算前に、空白や記号、大文字小文字の違いを取り除く
+func normalizeForFingerprint(text string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			return unicode.ToLower(r)
+		} else if unicode.IsSpace(r) {
+			return ' '
+		}
+		return -1
+	}, strings.Join(strings.Fields(text), " "))
+}
@@ -0,0 +1,59 @@
+package www
+
+import "testing"
+
+func TestContentHash(t *testing.T) {
+	a := ContentHash("Hello,   World!\nThis is gokurou.")
+	b := ContentHash("hello world this is gokurou")
+	c := ContentHash("hello world this is another crawler")
+
+	if a != b {
+		t.Errorf("ContentHash() returns different hash for same content(%s, %s)", a, b)
+	}
+
+	if a == c {
+		t.Errorf("ContentHash() returns same hash for different content")
+	}
+}
+
+func TestSimHash(t *testing.T) {
+	base := "The quick brown fox jumps over the lazy dog. This page is mirrored on many sites and contains the same text."
+	near := "The quick brown fox jumps over the lazy dog. This page is mirrored on many sites and contains the same text!!"
+	nearer := "The quick brown fox jumps over the lazy cat. This page is mirrored on many sites and contains the same text."
+	far := "gokurouは大量のWebページを高速にクロールするためのクローラーです。3日で1億ページを目指しています。"
+
+	if d := HammingDistance(SimHash(base), SimHash(near)); d != 0 {
+		t.Errorf("HammingDistance(SimHash(base), SimHash(near)) = %d, want = 0", d)
+	}
+
+	if d := HammingDistance(SimHash(base), SimHash(nearer)); d > 6 {
+		t.Errorf("HammingDistance(SimHash(base), SimHash(nearer)) = %d, want <= 6", d)
+	}
+
+	if d := HammingDistance(SimHash(base), SimHash(far)); d < 16 {
+		t.Errorf("HammingDistance(SimHash(base), SimHash(far)) = %d, want >= 16", d)
+	}
+
+	if SimHash("") != 0 {
+		t.Errorf("SimHash(\"\") = %d, want = 0", SimHash(""))
+	}
+}
+
+func TestHammingDistance(t *testing.T) {
+	tests := []struct {
+		a, b uint64
+		want int
+	}{
+		{a: 0, b: 0, want: 0},
+		{a: 0, b: 0xff, want: 8},
+		{a: 0xf0f0, b: 0x0ff0, want: 8},
+		{a: 0, b: ^uint64(0), want: 64},
+	}
+
+	for _, tt := range tests {
+		got := HammingDistance(tt.a, tt.b)
+		if got != tt.want {
+			t.Errorf("HammingDistance(%x, %x) = %d, want = %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
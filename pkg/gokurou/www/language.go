@@ -0,0 +1,221 @@
+package www
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	// 言語を推測するために最低限必要な文字数
+	minDetectableRunes = 10
+
+	// 言語プロファイルとして保持するtrigramの数
+	languageProfileSize = 300
+)
+
+// 文字種から言語を決められる場合の、文字種と言語の対応
+var scriptLanguages = []struct {
+	table *unicode.RangeTable
+	lang  string
+}{
+	{table: unicode.Hangul, lang: "ko"},
+	{table: unicode.Cyrillic, lang: "ru"},
+	{table: unicode.Arabic, lang: "ar"},
+	{table: unicode.Hebrew, lang: "he"},
+	{table: unicode.Thai, lang: "th"},
+	{table: unicode.Greek, lang: "el"},
+	{table: unicode.Devanagari, lang: "hi"},
+}
+
+// ラテン文字を用いる言語について、trigramのプロファイルを生成するための文章
+var languageSamples = map[string]string{
+	"en": "the quick brown fox jumps over the lazy dog. this is a page that was written in english and it " +
+		"contains some of the most common words which are used in the language. we have been there for the " +
+		"people who would like to know what they should do with their time and how they can find it here. " +
+		"you will find information about our company and the services that we provide for all of our customers.",
+	"de": "der schnelle braune fuchs springt über den faulen hund. dies ist eine seite die auf deutsch " +
+		"geschrieben wurde und sie enthält einige der häufigsten wörter der sprache. wir sind für die menschen " +
+		"da die wissen möchten was sie mit ihrer zeit machen sollen und wie sie es hier finden können. " +
+		"sie finden hier informationen über unser unternehmen und die leistungen die wir für unsere kunden anbieten.",
+	"fr": "le renard brun rapide saute par dessus le chien paresseux. ceci est une page qui a été écrite en " +
+		"français et elle contient quelques uns des mots les plus courants de la langue. nous sommes là pour les " +
+		"personnes qui voudraient savoir ce qu'elles doivent faire de leur temps et comment elles peuvent le trouver. " +
+		"vous trouverez des informations sur notre entreprise et les services que nous proposons à nos clients.",
+	"es": "el rápido zorro marrón salta sobre el perro perezoso. esta es una página que fue escrita en español " +
+		"y contiene algunas de las palabras más comunes que se usan en el idioma. estamos aquí para las personas " +
+		"que quieren saber qué deben hacer con su tiempo y cómo pueden encontrarlo aquí. usted encontrará " +
+		"información sobre nuestra empresa y los servicios que ofrecemos a todos nuestros clientes.",
+	"it": "la veloce volpe marrone salta sopra il cane pigro. questa è una pagina che è stata scritta in italiano " +
+		"e contiene alcune delle parole più comuni che sono usate nella lingua. siamo qui per le persone che " +
+		"vorrebbero sapere che cosa fare con il loro tempo e come possono trovarlo qui. troverete informazioni " +
+		"sulla nostra azienda e sui servizi che forniamo a tutti i nostri clienti.",
+	"pt": "a rápida raposa marrom pula sobre o cão preguiçoso. esta é uma página que foi escrita em português " +
+		"e contém algumas das palavras mais comuns que são usadas na língua. estamos aqui para as pessoas que " +
+		"gostariam de saber o que devem fazer com o seu tempo e como podem encontrá-lo aqui. você vai encontrar " +
+		"informações sobre a nossa empresa e os serviços que oferecemos para todos os nossos clientes.",
+	"nl": "de snelle bruine vos springt over de luie hond. dit is een pagina die in het nederlands is geschreven " +
+		"en die bevat enkele van de meest voorkomende woorden die in de taal worden gebruikt. wij zijn er voor de " +
+		"mensen die willen weten wat ze met hun tijd moeten doen en hoe ze het hier kunnen vinden. u vindt hier " +
+		"informatie over ons bedrijf en de diensten die wij voor al onze klanten leveren.",
+}
+
+// 言語毎のtrigramの順位
+var languageProfiles = buildLanguageProfiles()
+
+// 言語タグ("ja-JP"や"en-US, fr"など)を正規化し、主言語を表す小文字の部分だけを返す
+func NormalizeLanguageTag(tag string) string {
+	tag = strings.TrimSpace(strings.SplitN(tag, ",", 2)[0])
+	tag = strings.ToLower(strings.SplitN(strings.Replace(tag, "_", "-", -1), "-", 2)[0])
+
+	if len(tag) < 2 || len(tag) > 3 {
+		return ""
+	}
+
+	for _, r := range tag {
+		if r < 'a' || r > 'z' {
+			return ""
+		}
+	}
+
+	return tag
+}
+
+// 言語が、言語のフィルタで許可されたものかどうかを返す
+// フィルタが空の場合や、言語が不明な場合は許可されたものとする
+func AcceptsLanguage(filter []string, lang string) bool {
+	if len(filter) == 0 || len(lang) == 0 {
+		return true
+	}
+
+	for _, l := range filter {
+		if l == lang {
+			return true
+		}
+	}
+	return false
+}
+
+// テキストの内容から言語を推測し、ISO 639-1の言語コードを返す
+// 推測できない場合は空文字列を返す
+func DetectLanguage(text string) string {
+	var kana, han, latin, letters int
+	scripts := make(map[string]int)
+
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			kana++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		default:
+			for _, sl := range scriptLanguages {
+				if unicode.Is(sl.table, r) {
+					scripts[sl.lang]++
+					break
+				}
+			}
+		}
+	}
+
+	if letters < minDetectableRunes {
+		return ""
+	}
+
+	// 仮名が含まれていれば日本語、漢字のみなら中国語とみなす
+	if kana > 0 && kana+han >= letters/2 {
+		return "ja"
+	} else if han >= letters/2 {
+		return "zh"
+	}
+
+	for lang, count := range scripts {
+		if count >= letters/2 {
+			return lang
+		}
+	}
+
+	if latin >= letters/2 {
+		return detectLatinLanguage(text)
+	}
+
+	return ""
+}
+
+// trigramのプロファイル間の距離(out-of-place measure)が最も小さい言語を返す
+func detectLatinLanguage(text string) string {
+	ranks := rankTrigrams(text)
+
+	best := ""
+	bestDistance := -1
+	for lang, profile := range languageProfiles {
+		distance := 0
+		for trigram, rank := range ranks {
+			if profileRank, ok := profile[trigram]; ok {
+				if profileRank > rank {
+					distance += profileRank - rank
+				} else {
+					distance += rank - profileRank
+				}
+			} else {
+				distance += languageProfileSize
+			}
+		}
+
+		if bestDistance < 0 || distance < bestDistance {
+			best = lang
+			bestDistance = distance
+		}
+	}
+
+	return best
+}
+
+func buildLanguageProfiles() map[string]map[string]int {
+	profiles := make(map[string]map[string]int, len(languageSamples))
+	for lang, sample := range languageSamples {
+		profiles[lang] = rankTrigrams(sample)
+	}
+	return profiles
+}
+
+// テキスト中のtrigramを出現頻度順に並べ、上位languageProfileSize個の順位を返す
+func rankTrigrams(text string) map[string]int {
+	counts := make(map[string]int)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		runes := []rune("_" + word + "_")
+		for i := 0; i+3 <= len(runes); i++ {
+			counts[string(runes[i:i+3])]++
+		}
+	}
+
+	trigrams := make([]string, 0, len(counts))
+	for trigram := range counts {
+		trigrams = append(trigrams, trigram)
+	}
+
+	sort.Slice(trigrams, func(i, j int) bool {
+		if counts[trigrams[i]] != counts[trigrams[j]] {
+			return counts[trigrams[i]] > counts[trigrams[j]]
+		}
+		return trigrams[i] < trigrams[j]
+	})
+
+	if len(trigrams) > languageProfileSize {
+		trigrams = trigrams[:languageProfileSize]
+	}
+
+	ranks := make(map[string]int, len(trigrams))
+	for i, trigram := range trigrams {
+		ranks[trigram] = i
+	}
+
+	return ranks
+}
@@ -0,0 +1,73 @@
+package www
+
+import "testing"
+
+func TestNormalizeLanguageTag(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "ja", want: "ja"},
+		{in: "ja-JP", want: "ja"},
+		{in: "EN_us", want: "en"},
+		{in: "en-US, fr", want: "en"},
+		{in: " fil ", want: "fil"},
+		{in: "", want: ""},
+		{in: "x", want: ""},
+		{in: "12-34", want: ""},
+	}
+
+	for _, tt := range tests {
+		got := NormalizeLanguageTag(tt.in)
+		if got != tt.want {
+			t.Errorf("NormalizeLanguageTag(%s) = %s, want = %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "これは日本語で書かれた文章です。", want: "ja"},
+		{in: "这是用中文写的文章，我们今天去公园。", want: "zh"},
+		{in: "이것은 한국어로 쓰여진 문장입니다.", want: "ko"},
+		{in: "Это предложение написано на русском языке.", want: "ru"},
+		{in: "This article describes how the crawler works and what you should know about it.", want: "en"},
+		{in: "Dieser Artikel beschreibt, wie der Crawler funktioniert und was Sie darüber wissen sollten.", want: "de"},
+		{in: "Cet article décrit comment fonctionne le robot et ce que vous devez savoir à son sujet.", want: "fr"},
+		{in: "Este artículo describe cómo funciona el rastreador y lo que usted debe saber sobre él.", want: "es"},
+		{in: "Questo articolo descrive come funziona il crawler e che cosa dovreste sapere.", want: "it"},
+		{in: "Dit artikel beschrijft hoe de crawler werkt en wat u erover moet weten.", want: "nl"},
+		{in: "short", want: ""},
+		{in: "1234567890 !!!", want: ""},
+	}
+
+	for _, tt := range tests {
+		got := DetectLanguage(tt.in)
+		if got != tt.want {
+			t.Errorf("DetectLanguage(%s) = %s, want = %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestAcceptsLanguage(t *testing.T) {
+	tests := []struct {
+		filter []string
+		lang   string
+		want   bool
+	}{
+		{filter: []string{"ja", "en"}, lang: "en", want: true},
+		{filter: []string{"ja", "en"}, lang: "fr", want: false},
+		{filter: []string{"ja"}, lang: "", want: true},
+		{filter: nil, lang: "fr", want: true},
+	}
+
+	for _, tt := range tests {
+		got := AcceptsLanguage(tt.filter, tt.lang)
+		if got != tt.want {
+			t.Errorf("AcceptsLanguage(%v, %s) = %v, want = %v", tt.filter, tt.lang, got, tt.want)
+		}
+	}
+}
@@ -9,17 +9,40 @@ import (
 )
 
 type Page struct {
-	title    string
-	allURL   []*SanitizedURL
-	noIndex  bool
-	noFollow bool
+	title     string
+	allURL    []*SanitizedURL
+	links     []*Link
+	noIndex   bool
+	noFollow  bool
+	mainText  string
+	wordCount int
+	language  string
+}
+
+// ページ中のリンク(<a>)を表す型
+type Link struct {
+	URL  *SanitizedURL
+	Text string // アンカーテキスト
+	Rel  string // rel属性の値(小文字)
 }
 
 func ParseHTML(r io.Reader, baseURL *SanitizedURL) (*Page, error) {
-	page := &Page{allURL: make([]*SanitizedURL, 0, 100)}
+	page := &Page{allURL: make([]*SanitizedURL, 0, 100), links: make([]*Link, 0, 100)}
 	tokenizer := html.NewTokenizer(r)
+	extractor := newTextExtractor()
 	waitTitle := false
 
+	// アンカーテキストを収集中のリンク
+	var anchor *Link
+	anchorText := make([]string, 0, 10)
+	closeAnchor := func() {
+		if anchor != nil {
+			anchor.Text = strings.Join(strings.Fields(strings.Join(anchorText, " ")), " ")
+			anchor = nil
+		}
+		anchorText = anchorText[:0]
+	}
+
 	var err error
 
 TOKENIZE:
@@ -33,8 +56,17 @@ TOKENIZE:
 
 		case html.StartTagToken, html.SelfClosingTagToken:
 			tagBytes, _ := tokenizer.TagName()
+			tagName := strings.ToLower(string(tagBytes))
+
+			extractor.startTag(tagName)
+			if tt == html.SelfClosingTagToken {
+				extractor.endTag(tagName)
+			}
+
+			switch tagName {
+			case "html":
+				page.language = NormalizeLanguageTag(readAttrs(tokenizer)["lang"])
 
-			switch strings.ToLower(string(tagBytes)) {
 			case "title":
 				waitTitle = true
 
@@ -48,18 +80,43 @@ TOKENIZE:
 				page.noFollow = strings.Contains(strings.ToLower(attrs["content"]), "nofollow")
 
 			case "a":
-				normalized, err := generateSanitizedURL(baseURL, readAttrs(tokenizer))
+				closeAnchor() // 閉じられていない<a>は次の<a>の開始で閉じたものとする
+
+				attrs := readAttrs(tokenizer)
+				link, err := generateLink(baseURL, attrs)
 				if err != nil {
 					continue
 				}
-				page.allURL = append(page.allURL, normalized)
+
+				page.links = append(page.links, link)
+				if tt == html.StartTagToken {
+					anchor = link
+				}
+
+				if link.Rel != "nofollow" {
+					page.allURL = append(page.allURL, link.URL)
+				}
+			}
+
+		case html.EndTagToken:
+			tagBytes, _ := tokenizer.TagName()
+			tagName := strings.ToLower(string(tagBytes))
+			extractor.endTag(tagName)
+
+			if tagName == "a" {
+				closeAnchor()
 			}
 
 		case html.TextToken:
+			text := string(tokenizer.Text()) // Textは2回目以降の呼び出しで空を返すため、1度だけ呼び出す
 			if !waitTitle {
+				extractor.text(text)
+				if anchor != nil {
+					anchorText = append(anchorText, text)
+				}
 				continue
 			}
-			page.title = string(tokenizer.Text())
+			page.title = text
 			waitTitle = false
 		}
 	}
@@ -68,6 +125,10 @@ TOKENIZE:
 		return nil, fmt.Errorf("failed to parse html: %v", err)
 	}
 
+	closeAnchor()
+	page.mainText = extractor.mainText()
+	page.wordCount = countWords(page.mainText)
+
 	return page, nil
 }
 
@@ -86,11 +147,7 @@ func readAttrs(t *html.Tokenizer) map[string]string {
 	return attrs
 }
 
-func generateSanitizedURL(baseURL *SanitizedURL, attrs map[string]string) (*SanitizedURL, error) {
-	if strings.ToLower(attrs["rel"]) == "nofollow" {
-		return nil, fmt.Errorf("'a' tag has rel='nofollow' attribute")
-	}
-
+func generateLink(baseURL *SanitizedURL, attrs map[string]string) (*Link, error) {
 	href, ok := attrs["href"]
 	if !ok {
 		return nil, fmt.Errorf("'a' tag does NOT have 'href' attribute")
@@ -101,7 +158,7 @@ func generateSanitizedURL(baseURL *SanitizedURL, attrs map[string]string) (*Sani
 		return nil, fmt.Errorf("can't fetch url: %v", err)
 	}
 
-	return fetched, nil
+	return &Link{URL: fetched, Rel: strings.ToLower(attrs["rel"])}, nil
 }
 
 func (p *Page) Title() string {
@@ -116,6 +173,27 @@ func (p *Page) AllURL() []*SanitizedURL {
 	return p.allURL
 }
 
+// ページ中の全てのリンクを返す
+// AllURLと異なり、nofollowが指定されたリンクも含む
+func (p *Page) Links() []*Link {
+	return p.links
+}
+
 func (p *Page) NoIndex() bool {
 	return p.noIndex
 }
+
+// 定型部分(ナビゲーションやフッター等)を除いた本文を返す
+func (p *Page) MainText() string {
+	return p.mainText
+}
+
+// 本文の単語数を返す
+func (p *Page) WordCount() int {
+	return p.wordCount
+}
+
+// <html lang>で宣言された言語を返す
+func (p *Page) Language() string {
+	return p.language
+}
@@ -37,6 +37,10 @@ func TestParseHTML(t *testing.T) {
 			t.Errorf("ParseHTML(testdata/test.html).NoIndex() = false, want = true")
 		}
 
+		if html.Language() != "ja" {
+			t.Errorf("ParseHTML(testdata/test.html).Language() = %s, want = ja", html.Language())
+		}
+
 		if len(html.AllURL()) != 3 {
 			t.Errorf("len(ParseHTML(testdata/test.html).AllURL()) = %d, want = 3", len(html.AllURL()))
 		}
@@ -49,6 +53,34 @@ func TestParseHTML(t *testing.T) {
 		}
 	})
 
+	t.Run("リンクのアンカーテキストとrel属性を収集する", func(t *testing.T) {
+		html, err := ParseHTML(openTestData("testdata/test.html"), baseURL)
+		if err != nil {
+			t.Errorf("ParseHTML(testdata/test.html) = error, want = no error")
+			return
+		}
+
+		want := []Link{
+			{Text: "これはリンクです"},
+			{Text: ""},
+			{Text: "これは相対パスなURLです"},
+			{Text: "これはnofollowなURLです", Rel: "nofollow"},
+		}
+		wantURL := []string{"http://example1.com", "https://example2.com", "http://www.example.com/a/b/rel.html", "http://example4.com"}
+
+		links := html.Links()
+		if len(links) != len(want) {
+			t.Errorf("len(ParseHTML(testdata/test.html).Links()) = %d, want = %d", len(links), len(want))
+			return
+		}
+
+		for i, link := range links {
+			if link.URL.String() != wantURL[i] || link.Text != want[i].Text || link.Rel != want[i].Rel {
+				t.Errorf("ParseHTML(testdata/test.html).Links()[%d] = %+v, want = %s %+v", i, link, wantURL[i], want[i])
+			}
+		}
+	})
+
 	t.Run("nofollowが全面的に指定されているHTMLの場合", func(t *testing.T) {
 		html, err := ParseHTML(openTestData("testdata/nofollow.html"), baseURL)
 		if err != nil {
@@ -0,0 +1,42 @@
+package www
+
+// URL中の明示的なポート指定の扱い
+type PortPolicyMode string
+
+const (
+	DenyPorts        PortPolicyMode = "deny"       // デフォルトポート以外を指定したURLは全て拒否する
+	AllowListedPorts PortPolicyMode = "allow_list" // 許可したポートを指定したURLのみ受け入れる
+	AllowAllPorts    PortPolicyMode = "allow_all"  // どのポートを指定したURLでも受け入れる
+)
+
+// SanitizedURLを生成する際に適用する、ポート指定に関するポリシー
+type PortPolicy struct {
+	Mode    PortPolicyMode
+	Allowed []string // AllowListedPortsの場合に許可するポート
+}
+
+// デフォルトのポート指定に関するポリシーを返す
+func DefaultPortPolicy() *PortPolicy {
+	return &PortPolicy{Mode: DenyPorts}
+}
+
+// ポートの指定を許可するかどうかを返す。portはデフォルトポートを取り除いた後のものを与えること
+func (policy *PortPolicy) allows(port string) bool {
+	if len(port) == 0 {
+		return true
+	}
+
+	switch policy.Mode {
+	case AllowAllPorts:
+		return true
+
+	case AllowListedPorts:
+		for _, allowed := range policy.Allowed {
+			if allowed == port {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,30 @@
+package www
+
+import "testing"
+
+func TestSanitizedURLFromString_PortPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *PortPolicy
+		in     string
+		valid  bool
+	}{
+		{name: "デフォルトポートの指定は常に許可する", policy: DefaultPortPolicy(), in: "https://example.com:443/", valid: true},
+		{name: "拒否する場合", policy: DefaultPortPolicy(), in: "http://example.com:8080/", valid: false},
+		{name: "拒否する場合(localhost)", policy: DefaultPortPolicy(), in: "http://127.0.0.1:8080/", valid: false},
+		{name: "許可したポートの場合", policy: &PortPolicy{Mode: AllowListedPorts, Allowed: []string{"8080"}}, in: "http://example.com:8080/", valid: true},
+		{name: "許可していないポートの場合", policy: &PortPolicy{Mode: AllowListedPorts, Allowed: []string{"8080"}}, in: "http://example.com:8081/", valid: false},
+		{name: "全て許可する場合", policy: &PortPolicy{Mode: AllowAllPorts}, in: "http://example.com:8081/", valid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sanitized, err := NewSanitizer(nil, tt.policy).FromString(tt.in)
+			if tt.valid && err != nil {
+				t.Errorf("SanitizedURLFromString(%s) = %v, want = no error", tt.in, err)
+			} else if !tt.valid && sanitized != nil {
+				t.Errorf("SanitizedURLFromString(%s) = %s, want = error", tt.in, sanitized)
+			}
+		})
+	}
+}
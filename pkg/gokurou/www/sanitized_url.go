@@ -2,6 +2,7 @@ package www
 
 import (
 	"fmt"
+	"net"
 	"net/url"
 	"path"
 	"strings"
@@ -11,11 +12,46 @@ import (
 
 // クローラー中で扱うことが安全なURLを表す型
 type SanitizedURL struct {
-	url *url.URL
+	url       *url.URL
+	sanitizer *Sanitizer // このURLを生成したSanitizer。Join等で生成するURLにも同じルールを適用する
 }
 
-// URLをサニタイズしてSanitizedURLを返す
+// SanitizedURLを生成する際に適用するルールをまとめたもの
+// 生成後に変更しないため、並行して用いても安全
+type Sanitizer struct {
+	rules *CanonicalRules
+	ports *PortPolicy
+}
+
+// デフォルトのルールを適用するSanitizer
+var defaultSanitizer = NewSanitizer(nil, nil)
+
+// 与えられた正規化のルールとポート指定に関するポリシーを適用するSanitizerを返す
+// それぞれnilの場合はデフォルトのものを適用する
+func NewSanitizer(rules *CanonicalRules, ports *PortPolicy) *Sanitizer {
+	if rules == nil {
+		rules = DefaultCanonicalRules()
+	}
+
+	if ports == nil {
+		ports = DefaultPortPolicy()
+	}
+
+	return &Sanitizer{rules: rules, ports: ports}
+}
+
+// デフォルトのルールでURLをサニタイズしてSanitizedURLを返す
 func SanitizedURLFromURL(u *url.URL) (*SanitizedURL, error) {
+	return defaultSanitizer.FromURL(u)
+}
+
+// デフォルトのルールで文字列で表されるURLをサニタイズしてSanitizedURLを返す
+func SanitizedURLFromString(s string) (*SanitizedURL, error) {
+	return defaultSanitizer.FromString(s)
+}
+
+// URLをサニタイズしてSanitizedURLを返す
+func (sanitizer *Sanitizer) FromURL(u *url.URL) (*SanitizedURL, error) {
 	if !u.IsAbs() {
 		return nil, fmt.Errorf("url is NOT absolute url")
 	}
@@ -29,39 +65,58 @@ func SanitizedURLFromURL(u *url.URL) (*SanitizedURL, error) {
 		return nil, fmt.Errorf("url's scheme is invalid: %s", sScheme)
 	}
 
-	// これは微妙にテストも考慮しており、localhostならportの指定があっても許可する
-	if !strings.HasPrefix(u.Host, "127.0.0.1:") && len(u.Port()) > 0 {
+	rules := sanitizer.rules
+	port := u.Port()
+	if rules.removesPort(sScheme, port) {
+		port = ""
+	}
+
+	if !sanitizer.ports.allows(port) {
 		return nil, fmt.Errorf("url's has port")
 	}
 
-	sHost, err := idna.ToASCII(u.Host)
+	sHost, err := idna.ToASCII(u.Hostname())
 	if err != nil {
 		return nil, fmt.Errorf("url has invalid host: %s", sHost)
 	}
 
+	sHost = rules.canonicalHost(sHost)
+	if len(port) > 0 {
+		sHost = net.JoinHostPort(sHost, port)
+	} else if strings.Contains(sHost, ":") {
+		sHost = "[" + sHost + "]" // IPv6アドレス
+	}
+
 	if len(sHost) > 255 {
 		return nil, fmt.Errorf("url's host is too long")
 	}
 
-	sPath := u.Path
-	sQuery := u.Query().Encode()
+	sPath := rules.canonicalPath(u.Path)
+	sQuery := rules.canonicalQuery(u.RawQuery)
 
 	if len(sPath)+len(sQuery) > 1000 {
 		return nil, fmt.Errorf("url's path and query is too long")
 	}
 
+	var sFragment string
+	if !rules.RemoveFragment {
+		sFragment = u.Fragment
+	}
+
 	return &SanitizedURL{
 		url: &url.URL{
 			Scheme:   sScheme,
 			Host:     sHost,
 			Path:     sPath,
 			RawQuery: sQuery,
+			Fragment: sFragment,
 		},
+		sanitizer: sanitizer,
 	}, nil
 }
 
 // 文字列で表されるURLをサニタイズしてSanitizedURLを返す
-func SanitizedURLFromString(s string) (*SanitizedURL, error) {
+func (sanitizer *Sanitizer) FromString(s string) (*SanitizedURL, error) {
 	if len(s) > 2000 {
 		return nil, fmt.Errorf("url is too long")
 	}
@@ -71,17 +126,23 @@ func SanitizedURLFromString(s string) (*SanitizedURL, error) {
 		return nil, fmt.Errorf("can't parse url: %s", u)
 	}
 
-	return SanitizedURLFromURL(u)
+	return sanitizer.FromURL(u)
 }
 
-// URLのホスト部を返す
+// URLのホスト部を返す。ポートの指定がある場合はそれも含む
 func (sanitized *SanitizedURL) Host() string {
 	return sanitized.url.Host
 }
 
+// URLのホスト部からポートの指定を除いたホスト名を返す
+func (sanitized *SanitizedURL) Hostname() string {
+	return sanitized.url.Hostname()
+}
+
 // ホスト部が表すドメインのTLDを返す
+// "co.jp"のような登録可能なドメインの単位を知りたい場合はPublicSuffixを用いること
 func (sanitized *SanitizedURL) TLD() string {
-	labels := strings.Split(sanitized.Host(), ".")
+	labels := strings.Split(sanitized.Hostname(), ".")
 	return labels[len(labels)-1]
 }
 
@@ -90,11 +151,21 @@ func (sanitized *SanitizedURL) Path() string {
 	return sanitized.url.Path
 }
 
-// このURLに対して有効なrobots.txtのURLを返す
+// URLのクエリ部を返す
+func (sanitized *SanitizedURL) Query() string {
+	return sanitized.url.RawQuery
+}
+
+// このURLに対して有効なrobots.txtのURLを返す(スキームとポートを含むホスト部はこのURLと同じになる)
 func (sanitized *SanitizedURL) RobotsTxtURL() *SanitizedURL {
-	robotsTxt, _ := url.Parse(sanitized.String())
-	robotsTxt.Path = "/robots.txt"
-	return &SanitizedURL{url: robotsTxt}
+	return &SanitizedURL{
+		url: &url.URL{
+			Scheme: sanitized.url.Scheme,
+			Host:   sanitized.url.Host,
+			Path:   "/robots.txt",
+		},
+		sanitizer: sanitized.sanitizer,
+	}
 }
 
 // サニタイズ済みURLの文字列表現を返す
@@ -121,9 +192,10 @@ func (sanitized *SanitizedURL) Join(str string) (*SanitizedURL, error) {
 			Scheme:   sanitized.url.Scheme,
 			Host:     sanitized.url.Host,
 			Path:     newPath,
-			RawQuery: u.Query().Encode(),
+			RawQuery: u.RawQuery,
+			Fragment: u.Fragment,
 		}
 	}
 
-	return SanitizedURLFromURL(u)
+	return sanitized.sanitizer.FromURL(u)
 }
@@ -102,15 +102,39 @@ func TestSanitizedURL_TLD(t *testing.T) {
 }
 
 func TestSanitizedURL_RobotsTxtURL(t *testing.T) {
-	url, err := SanitizedURLFromString("http://example.com/path/to/page")
-	if err != nil {
-		t.Error(err)
+	sanitizer := NewSanitizer(nil, &PortPolicy{Mode: AllowAllPorts})
+
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "http://example.com/path/to/page", want: "http://example.com/robots.txt"},
+		{in: "https://example.com:8443/path/to/page?q=1", want: "https://example.com:8443/robots.txt"},
+	}
+
+	for _, tt := range tests {
+		url, err := sanitizer.FromString(tt.in)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if url.RobotsTxtURL().String() != tt.want {
+			t.Errorf("RobotsTxtURL() = %s, want = %s", url.RobotsTxtURL().String(), tt.want)
+		}
 	}
+}
+
+func TestSanitizedURL_Hostname(t *testing.T) {
+	sanitizer := NewSanitizer(nil, &PortPolicy{Mode: AllowAllPorts})
 
-	want := "http://example.com/robots.txt"
+	url, err := sanitizer.FromString("http://example.com:8080/path")
+	if err != nil {
+		panic(err)
+	}
 
-	if url.RobotsTxtURL().String() != want {
-		t.Errorf("RobotsTxtURL() = %s, want = %s", url.RobotsTxtURL().String(), want)
+	if url.Host() != "example.com:8080" || url.Hostname() != "example.com" {
+		t.Errorf("Host() = %s, Hostname() = %s, want = example.com:8080, example.com", url.Host(), url.Hostname())
 	}
 }
 